@@ -9,6 +9,7 @@ import (
 func Command() *cobra.Command {
 	opts := struct {
 		delete bool
+		part   int
 	}{}
 
 	cmd := &cobra.Command{
@@ -18,41 +19,48 @@ func Command() *cobra.Command {
 		Long: "Blacklist a wallpaper.\n\n" +
 			"Add the current wallpaper on a specific display to the blacklist or " +
 			"optionally provide a path to a specific image file to blacklist.\n\n" +
-			"Blacklisted images will not be set as wallpapers.",
+			"Blacklisted images will not be set as wallpapers.\n\n" +
+			"If the wallpaper is a collage, every image in it is blacklisted " +
+			"unless --part selects one of them, numbered from 1.",
 		Example: "  blacklist current wallpaper on display 0:\n" +
 			"    walsh bl 0\n\n" +
 			"  blacklist a specific image file:\n" +
 			"    walsh bl path/to/image.jpg\n\n" +
 			"  blacklist wallpaper and remove the file:\n" +
-			"    walsh bl --rm 0",
+			"    walsh bl --rm 0\n\n" +
+			"  blacklist the second image of a collage on display 0:\n" +
+			"    walsh bl --part 2 0",
 		Run: func(cmd *cobra.Command, args []string) {
 			displayArg, sess, err := cli.Setup(cmd, args)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			// Read current file
-			currentFile, err := sess.ReadCurrent()
+			// Get display's current wallpaper
+			display, err := sess.ReadCurrentDisplay(displayArg)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			// Get display's current wallpaper
-			display, err := currentFile.Display(displayArg)
-			// _, display, err := sess.GetDisplay(displayArg)
-			if err != nil {
-				log.Fatal(err)
+			images := display.Current.Images()
+			if opts.part > 0 {
+				if opts.part > len(images) {
+					log.Fatalf("The wallpaper on display %s has %d images", displayArg, len(images))
+				}
+				images = images[opts.part-1 : opts.part]
 			}
 
 			// Write to blacklist
-			log.Warnf("Blacklisting image %s", display.Current.Path)
-			err = sess.WriteList(sess.Config().BlacklistFile, display.Current)
-			if err != nil {
-				log.Fatal(err)
+			for _, image := range images {
+				log.Warnf("Blacklisting image %s", image.Path)
+				err = sess.Blacklist(display.Name, image)
+				if err != nil {
+					log.Fatal(err)
+				}
 			}
 
 			// Set new wallpaper
-			err = sess.SetWallpaper([]string{}, displayArg)
+			err = sess.SetWallpaper([]string{}, displayArg, sess.Config().Span.Enabled)
 			if err != nil {
 				log.Errorf("Error setting wallpaper: %s", err)
 				return
@@ -63,6 +71,8 @@ func Command() *cobra.Command {
 
 	cmd.Flags().BoolVarP(&opts.delete, "rm", "", false,
 		"delete the image from the source")
+	cmd.Flags().IntVarP(&opts.part, "part", "p", 0,
+		"only blacklist this image of a collage, numbered from 1")
 
 	return cmd
 }
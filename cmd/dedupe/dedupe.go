@@ -0,0 +1,105 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	opts := struct {
+		threshold int
+		delete    bool
+		blacklist bool
+	}{}
+
+	cmd := &cobra.Command{
+		Use:   "dedupe [flags] [sources...]",
+		Short: "find duplicate wallpapers",
+		Long: "Find identical and near-duplicate images in the sources, such as " +
+			"resized or recompressed copies.\n\n" +
+			"Images are compared by a perceptual hash. The threshold is how many " +
+			"bits of the 64-bit hashes can differ; 0 only finds images that look " +
+			"the same and a negative threshold only finds identical files.\n\n" +
+			"The best copy of each group is the one with the most pixels. The " +
+			"other copies can be deleted or blacklisted. Identical files share a " +
+			"checksum with the best copy, so they can only be deleted. Copies " +
+			"further than the threshold from the best copy are kept.\n\n" +
+			"Without sources, the configured sources, display sources and " +
+			"fallback sources are searched.",
+		Example: "  walsh dedupe\n" +
+			"  walsh dedupe --threshold 10 ~/Pictures/Wallpapers\n" +
+			"  walsh dedupe --delete",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sess, err := cli.Setup(cmd, []string{})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if opts.delete && opts.blacklist {
+				log.Fatal("Use either --delete or --blacklist")
+			}
+
+			threshold := sess.Config().NearDuplicateThreshold()
+			if cmd.Flags().Changed("threshold") {
+				threshold = opts.threshold
+			}
+
+			groups, err := sess.FindDuplicates(args, threshold)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			copies := 0
+			for _, group := range groups {
+				best := group[0]
+				fmt.Printf("keep  %s (%dx%d)\n", best.Path, best.Width, best.Height)
+
+				for _, dup := range group[1:] {
+					copies++
+					kept := ""
+					if !dup.Removable {
+						kept = ", kept"
+					}
+					if dup.Exact(best) {
+						fmt.Printf("  same  %s%s\n", dup.Path, kept)
+					} else {
+						fmt.Printf("  near  %s (%dx%d, distance %d%s)\n",
+							dup.Path, dup.Width, dup.Height, dup.Distance, kept)
+					}
+
+					// Never touch the best copy itself, or a copy that's
+					// only in the group through another near-duplicate.
+					switch {
+					case !dup.Removable || dup.Path == best.Path:
+					case opts.delete:
+						log.Infof("Deleting %s", dup.Path)
+						if err = os.Remove(dup.Path); err != nil {
+							log.Errorf("Error deleting %s: %s", dup.Path, err)
+						}
+					case opts.blacklist && !dup.Exact(best):
+						log.Infof("Blacklisting %s", dup.Path)
+						if err = sess.Blacklist("", dup.Image); err != nil {
+							log.Errorf("Error blacklisting %s: %s", dup.Path, err)
+						}
+					}
+				}
+				fmt.Println()
+			}
+
+			fmt.Printf("Found %d groups with %d copies\n", len(groups), copies)
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.threshold, "threshold", "t", 0,
+		"number of hash bits that can differ (default duplicate_threshold from the config)")
+	cmd.Flags().BoolVarP(&opts.delete, "delete", "", false,
+		"delete all but the best copy of each group")
+	cmd.Flags().BoolVarP(&opts.blacklist, "blacklist", "", false,
+		"blacklist all but the best copy of each group")
+
+	return cmd
+}
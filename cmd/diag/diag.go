@@ -32,6 +32,14 @@ func Command() *cobra.Command {
 			fmt.Printf("Architecture:     %s\n", runtime.GOARCH)
 			fmt.Println()
 
+			fmt.Printf("Detected Session: %s\n", sess.DetectedType())
+			fmt.Printf("Session In Use:   %s\n", sess.Type())
+			fmt.Printf("Set Tool:         %s\n", sess.SetTool())
+			if backend := sess.Config().Session; backend != "" {
+				fmt.Printf("Override:         %s\n", backend)
+			}
+			fmt.Println()
+
 			fmt.Printf("Detected Displays: %d\n", len(displays))
 			fmt.Println()
 
@@ -58,6 +66,17 @@ func Command() *cobra.Command {
 			fmt.Println("└────────┴──────────────┴─────────────────────────────────┘")
 			fmt.Println()
 
+			fmt.Println("Monitors:")
+			for _, display := range displays {
+				desc := display.Description()
+				if desc == "" {
+					desc = "(unknown)"
+				}
+				fmt.Printf("  %-12s %dx%d+%d+%d  %s\n", display.Name,
+					display.Width, display.Height, display.X, display.Y, desc)
+			}
+			fmt.Println()
+
 			fmt.Println("Configuration:")
 			fmt.Printf("  Config Dir:    %s\n", sess.Config().ListsDir)
 			fmt.Printf("  Cache Dir:     %s\n", sess.Config().CacheDir)
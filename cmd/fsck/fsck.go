@@ -0,0 +1,81 @@
+package fsck
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	opts := struct {
+		quarantine bool
+		dryRun     bool
+	}{}
+
+	cmd := &cobra.Command{
+		Use:   "fsck [flags] [sources...]",
+		Short: "check sources for bad images",
+		Long: "Check every image in the sources for empty, unreadable, corrupt or " +
+			"mislabeled files.\n\n" +
+			"Images are checked by their contents and decoded in full. Bad images " +
+			"are added to the invalid list so they aren't selected again, and " +
+			"moved to the quarantine directory with --quarantine. Mislabeled " +
+			"images still work, so they're only reported.\n\n" +
+			"Without sources, the configured sources, display sources and " +
+			"fallback sources are checked.",
+		Example: "  walsh fsck\n" +
+			"  walsh fsck --dry-run ~/Pictures/Wallpapers\n" +
+			"  walsh fsck --quarantine",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sess, err := cli.Setup(cmd, []string{})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if opts.quarantine && sess.Config().QuarantineDir == "" {
+				log.Fatal("Set quarantine_dir in the config to quarantine images")
+			}
+			if !opts.quarantine {
+				sess.Config().QuarantineDir = ""
+			}
+
+			checked, bad, err := sess.CheckSources(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			unusable := 0
+			for _, image := range bad {
+				fmt.Println(image.Err)
+				if image.Err.Usable() {
+					continue
+				}
+
+				unusable++
+				if opts.dryRun {
+					continue
+				}
+				if err = sess.RejectImage(image.Image); err != nil {
+					log.Errorf("Error rejecting image %s: %s", image.Path, err)
+				}
+			}
+
+			fmt.Printf("Checked %d images: %d bad, %d mislabeled\n",
+				checked, unusable, len(bad)-unusable)
+
+			if unusable > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.quarantine, "quarantine", "q", false,
+		"move bad images to the quarantine directory")
+	cmd.Flags().BoolVarP(&opts.dryRun, "dry-run", "n", false,
+		"only report bad images")
+
+	return cmd
+}
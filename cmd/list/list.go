@@ -56,23 +56,20 @@ func AddCommand() *cobra.Command {
 				log.Fatal(err)
 			}
 
-			// Read current file
-			currentFile, err := sess.ReadCurrent()
-			if err != nil {
-				log.Fatal(err)
-			}
-
 			// Get display's current wallpaper
-			display, err := currentFile.Display(displayArg)
+			display, err := sess.ReadCurrentDisplay(displayArg)
 			if err != nil {
 				log.Fatal(err)
 			}
 
+			// A collage is added as the images it's made from.
 			path := filepath.Join(sess.Config().ListsDir, listName+".json")
-			log.Infof("Adding %s to list %s", display.Current.Path, path)
-			err = sess.WriteList(path, display.Current)
-			if err != nil {
-				log.Fatal(err)
+			for _, image := range display.Current.Images() {
+				log.Infof("Adding %s to list %s", image.Path, path)
+				err = sess.WriteList(path, image)
+				if err != nil {
+					log.Fatal(err)
+				}
 			}
 		},
 	}
@@ -0,0 +1,50 @@
+package lockscreen
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	opts := struct {
+		wallpaper bool
+	}{}
+
+	cmd := &cobra.Command{
+		Use:     "lockscreen [flags] [sources...]",
+		Aliases: []string{"lock"},
+		Short:   "set the lock screen image",
+		Long: "Write a lock screen image for each display and point the " +
+			"configured swaylock and hyprlock configs and greeter background " +
+			"at them.\n\n" +
+			"A random image is picked for each display from the given sources, " +
+			"or the lock screen sources in the config. Without either, or with " +
+			"--wallpaper, each display's current wallpaper is used.",
+		Example: "  walsh lockscreen\n" +
+			"  walsh lockscreen ~/Pictures/Lock\n" +
+			"  walsh lockscreen --wallpaper",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sess, err := cli.Setup(cmd, []string{})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if opts.wallpaper {
+				err = sess.LockscreenFromWallpapers()
+			} else {
+				err = sess.SetLockscreen(args)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Info("Updated lock screen")
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.wallpaper, "wallpaper", "w", false,
+		"use the current wallpapers, even if lock screen sources are configured")
+
+	return cmd
+}
@@ -1,10 +1,14 @@
 package set
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/joshbeard/walsh/internal/session"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +19,8 @@ type setOptions struct {
 	srcs          []string
 	display       string
 	interval      int
+	span          bool
+	collage       bool
 }
 
 func Command() *cobra.Command {
@@ -46,6 +52,10 @@ func Command() *cobra.Command {
 		"ignore the history when selecting a random image")
 	cmd.Flags().IntVarP(&opts.interval, "interval", "t", 0,
 		"set interval for changing wallpapers")
+	cmd.Flags().BoolVarP(&opts.span, "span", "s", false,
+		"span a single image across all displays")
+	cmd.Flags().BoolVarP(&opts.collage, "collage", "C", false,
+		"set a collage of several images on each display")
 
 	return cmd
 }
@@ -67,15 +77,27 @@ func setWallpaper(cmd *cobra.Command, args []string, opts setOptions) error {
 		return err
 	}
 
-	err := retry(func() error {
-		display, sess, err := cli.Setup(cmd, args)
-		if err != nil {
-			return err
-		}
-		opts.display = display
-		return sess.SetWallpaper(opts.srcs, opts.display)
-	})
-	if err != nil {
+	// Serializes wallpaper changes between the ticker and the display watcher.
+	var mu sync.Mutex
+	setAll := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return retry(func() error {
+			display, sess, err := cli.Setup(cmd, args)
+			if err != nil {
+				return err
+			}
+			opts.display = display
+			if opts.collage {
+				enabled := true
+				sess.Config().Collage.Enabled = &enabled
+			}
+			return sess.SetWallpaper(opts.srcs, opts.display, opts.span || sess.Config().Span.Enabled)
+		})
+	}
+
+	if err := setAll(); err != nil {
 		log.Fatal(err)
 		return err
 	}
@@ -84,19 +106,16 @@ func setWallpaper(cmd *cobra.Command, args []string, opts setOptions) error {
 		return nil
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go watchDisplays(ctx, cmd, args, opts, &mu)
+
 	ticker := time.NewTicker(time.Duration(opts.interval) * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		err := retry(func() error {
-			display, sess, err := cli.Setup(cmd, args)
-			if err != nil {
-				return err
-			}
-			opts.display = display
-			return sess.SetWallpaper(opts.srcs, opts.display)
-		})
-		if err != nil {
+		if err := setAll(); err != nil {
 			log.Fatal(err)
 			return err
 		}
@@ -105,3 +124,49 @@ func setWallpaper(cmd *cobra.Command, args []string, opts setOptions) error {
 
 	return nil
 }
+
+// watchDisplays sets a wallpaper on newly connected displays as soon as the
+// session reports them, rather than waiting for the next interval.
+func watchDisplays(
+	ctx context.Context, cmd *cobra.Command, args []string, opts setOptions, mu *sync.Mutex,
+) {
+	display, sess, err := cli.Setup(cmd, args)
+	if err != nil {
+		log.Errorf("Error setting up display watcher: %s", err)
+		return
+	}
+
+	// Only a specific display was requested, so leave new displays alone.
+	if display != "" {
+		return
+	}
+
+	span := opts.span || sess.Config().Span.Enabled
+	err = sess.WatchDisplays(ctx, func(added []session.Display) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// A spanned image is laid out across every display, so re-span it.
+		if span {
+			log.Info("Displays changed, spanning a new wallpaper")
+			if err := sess.SetWallpaper(opts.srcs, "", true); err != nil {
+				log.Errorf("Error spanning wallpaper: %s", err)
+			}
+			return
+		}
+
+		for _, d := range added {
+			log.Infof("Display %s connected, setting wallpaper", d.Name)
+			if err := sess.SetWallpaper(opts.srcs, d.Name, false); err != nil {
+				log.Errorf("Error setting wallpaper for display %s: %s", d.Name, err)
+			}
+		}
+	})
+	if errors.Is(err, session.ErrWatchUnsupported) {
+		log.Debugf("Not watching for display changes: %s", err)
+		return
+	}
+	if err != nil {
+		log.Errorf("Error watching for display changes: %s", err)
+	}
+}
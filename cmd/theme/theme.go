@@ -0,0 +1,54 @@
+package theme
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	opts := struct {
+		image string
+		print bool
+	}{}
+
+	cmd := &cobra.Command{
+		Use:   "theme [flags] [display]",
+		Short: "generate a color scheme from the wallpaper",
+		Long: "Generate a 16 color palette from the current wallpaper, render " +
+			"the configured theme templates with it and run the reload " +
+			"commands.\n\n" +
+			"The wallpaper of the configured theme display is used, or of the " +
+			"first display. Give a display or an image to use instead.",
+		Example: "  walsh theme\n" +
+			"  walsh theme 1\n" +
+			"  walsh theme --image ~/Pictures/sunset.jpg --print",
+		Run: func(cmd *cobra.Command, args []string) {
+			display, sess, err := cli.Setup(cmd, args)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			palette, err := sess.UpdateTheme(display, opts.image)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if opts.print {
+				fmt.Printf("wallpaper   %s\n", palette.Wallpaper)
+				fmt.Printf("background  %s\n", palette.Background)
+				fmt.Printf("foreground  %s\n", palette.Foreground)
+				for i, c := range palette.Colors {
+					fmt.Printf("color%-5d %s\n", i, c)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.image, "image", "i", "", "generate the palette from an image")
+	cmd.Flags().BoolVarP(&opts.print, "print", "p", false, "print the palette")
+
+	return cmd
+}
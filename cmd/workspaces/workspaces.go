@@ -0,0 +1,54 @@
+package workspaces
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var reset bool
+
+	cmd := &cobra.Command{
+		Use:     "workspaces [flags]",
+		Aliases: []string{"ws"},
+		Short:   "give each workspace its own wallpaper",
+		Long: "Watch for workspace switches in Sway, i3 or Hyprland and set the " +
+			"wallpaper for the workspace shown on each display. A workspace is " +
+			"given a wallpaper the first time it's shown, from its configured " +
+			"sources or the display's, and keeps it on that display until it's " +
+			"blacklisted or the recorded wallpapers are reset.\n\n" +
+			"This runs until it's interrupted.",
+		Example: "  walsh workspaces\n" +
+			"  walsh workspaces --reset",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, sess, err := cli.Setup(cmd, args)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if reset {
+				if err = sess.ResetWorkspaces(); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err = sess.WatchWorkspaces(ctx); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&reset, "reset", "r", false,
+		"forget the wallpapers recorded for each workspace")
+
+	return cmd
+}
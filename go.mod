@@ -7,9 +7,11 @@ require (
 	github.com/boumenot/gocover-cobertura v1.5.0
 	github.com/charmbracelet/log v1.0.0
 	github.com/fatih/color v1.19.0
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/golangci/golangci-lint v1.64.8
 	github.com/segmentio/golines v0.13.0
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/image v0.30.0
 	golang.org/x/vuln v1.6.0
 	gopkg.in/yaml.v3 v3.0.1
 	mvdan.cc/gofumpt v0.10.0
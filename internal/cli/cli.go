@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/config"
@@ -15,6 +16,17 @@ func Setup(cmd *cobra.Command, args []string) (string, *session.Session, error)
 		return "", nil, fmt.Errorf("error loading config: %w", err)
 	}
 
+	// The --backend flag takes precedence over WALSH_BACKEND, which takes
+	// precedence over the session in the config.
+	backend, _ := cmd.Flags().GetString("backend")
+	if backend == "" {
+		backend = os.Getenv("WALSH_BACKEND")
+	}
+	if backend != "" {
+		log.Debugf("Overriding session with %s", backend)
+		cfg.Session = backend
+	}
+
 	sess, err := session.NewSession(cfg)
 	if err != nil {
 		return "", nil, fmt.Errorf("error creating session: %w", err)
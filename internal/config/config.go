@@ -1,6 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/adrg/xdg"
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/util"
@@ -9,10 +13,15 @@ import (
 
 type Config struct {
 	Sources                 []string `yaml:"sources"`
+	FallbackSources         []string `yaml:"fallback_sources,omitempty"`
 	ListsDir                string   `yaml:"lists_dir"`
 	BlacklistFile           string   `yaml:"blacklist"`
+	InvalidFile             string   `yaml:"invalid"`
+	QuarantineDir           string   `yaml:"quarantine_dir,omitempty"`
 	HistoryFile             string   `yaml:"history"`
 	CurrentFile             string   `yaml:"current"`
+	IndexFile               string   `yaml:"index"`
+	DuplicateThreshold      *int     `yaml:"duplicate_threshold"`
 	HistorySize             int      `yaml:"history_size"`
 	CacheDir                string   `yaml:"cache_dir"`
 	CacheSize               int      `yaml:"cache_size"`
@@ -21,6 +30,424 @@ type Config struct {
 	DeleteBlacklistedImages bool     `yaml:"delete_blacklisted_images"`
 	SetCommand              string   `yaml:"set_command"`
 	ViewCommand             string   `yaml:"view_command"`
+	Session                 string   `yaml:"session,omitempty"`
+
+	Portal  PortalConfig  `yaml:"portal,omitempty"`
+	Backend BackendConfig `yaml:"backend,omitempty"`
+	Span    SpanConfig    `yaml:"span,omitempty"`
+	Fit     FitConfig     `yaml:"fit,omitempty"`
+	Effects EffectsConfig `yaml:"effects,omitempty"`
+	Overlay OverlayConfig `yaml:"overlay,omitempty"`
+	Collage CollageConfig `yaml:"collage,omitempty"`
+
+	Transitions TransitionConfig `yaml:"transitions,omitempty"`
+	Theme       ThemeConfig      `yaml:"theme,omitempty"`
+	Hooks       HooksConfig      `yaml:"hooks,omitempty"`
+	Lockscreen  LockscreenConfig `yaml:"lockscreen,omitempty"`
+	Workspaces  WorkspacesConfig `yaml:"workspaces,omitempty"`
+
+	Schedule []PhaseConfig `yaml:"schedule,omitempty"`
+
+	Displays []DisplayConfig `yaml:"displays,omitempty"`
+}
+
+// defaultDuplicateThreshold is the duplicate threshold if it isn't
+// configured. Copies of an image are usually within a few bits of each other.
+const defaultDuplicateThreshold = 6
+
+// NearDuplicateThreshold returns how many bits of two images' perceptual
+// hashes can differ for them to count as near-duplicates. It's negative if
+// near-duplicates are allowed.
+func (c Config) NearDuplicateThreshold() int {
+	if c.DuplicateThreshold == nil {
+		return defaultDuplicateThreshold
+	}
+
+	return *c.DuplicateThreshold
+}
+
+// SessionOverride returns the session type and wallpaper tool to use from the
+// session setting, which is in the form "session[:tool]", e.g. "sway:swaybg".
+// Either may be empty, and a session of "auto" means to detect it.
+func (c Config) SessionOverride() (string, string) {
+	session, tool, _ := strings.Cut(strings.TrimSpace(c.Session), ":")
+	if strings.EqualFold(session, "auto") {
+		session = ""
+	}
+
+	return session, tool
+}
+
+// PortalConfig configures setting wallpapers through the XDG desktop
+// portal. SetOn is one of "background" (the default), "lockscreen" or
+// "both". ShowPreview asks the desktop to show a preview for the user to
+// confirm.
+type PortalConfig struct {
+	SetOn       string `yaml:"set_on,omitempty"`
+	ShowPreview bool   `yaml:"show_preview,omitempty"`
+}
+
+// BackendConfig defines a custom session backend from commands, for desktops
+// walsh has no built-in support for.
+//
+//   - Detect is run to check whether the backend applies to the current
+//     session. It matches if it exits successfully. If it's empty, the backend
+//     is always used.
+//   - ListDisplays prints the displays. With the "lines" parser (the default),
+//     each non-empty line is a display name. With the "json" parser, JSONPath
+//     selects the display names from the output, e.g. "outputs[*].name".
+//   - Set sets a wallpaper. {{path}}, {{display}} and {{index}} are replaced
+//     with the image path, display name and display index.
+//   - GetCurrent prints the current wallpaper for {{display}} or {{index}}. If
+//     it's empty, the last wallpaper walsh set is used.
+type BackendConfig struct {
+	Detect       string `yaml:"detect,omitempty"`
+	ListDisplays string `yaml:"list_displays,omitempty"`
+	Parser       string `yaml:"parser,omitempty"`
+	JSONPath     string `yaml:"json_path,omitempty"`
+	Set          string `yaml:"set,omitempty"`
+	GetCurrent   string `yaml:"get_current,omitempty"`
+}
+
+// Enabled returns true if the backend defines the commands it needs.
+func (b BackendConfig) Enabled() bool {
+	return b.ListDisplays != "" && b.Set != ""
+}
+
+// SpanConfig configures spanning a single image across every display, laid
+// out by the displays' positions. Bezel is the width of the gap between
+// adjacent displays, in layout pixels. That part of the image is skipped so
+// lines stay straight across the monitor frames.
+type SpanConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	Bezel   int  `yaml:"bezel,omitempty"`
+}
+
+// FitConfig configures fitting images to a display's resolution before
+// they're set, rather than leaving it to the wallpaper tool. Mode is one of
+// "fill", "fit", "center" or "tile", and fitting is off if it's empty or
+// "none". Background is the hex color around letterboxed images, and Focus
+// is the point kept in view when cropping, either a name such as "top" or
+// "x,y" fractions such as "0.5,0.3".
+type FitConfig struct {
+	Mode       string `yaml:"mode,omitempty"`
+	Background string `yaml:"background,omitempty"`
+	Focus      string `yaml:"focus,omitempty"`
+}
+
+// Merge returns the config with any fields set in o replacing its own.
+func (f FitConfig) Merge(o FitConfig) FitConfig {
+	if o.Mode != "" {
+		f.Mode = o.Mode
+	}
+	if o.Background != "" {
+		f.Background = o.Background
+	}
+	if o.Focus != "" {
+		f.Focus = o.Focus
+	}
+
+	return f
+}
+
+// EffectsConfig configures the effects applied to wallpapers. Fields that
+// aren't set leave the image unchanged, so configs can be layered.
+//
+//   - Blur is the blur radius in pixels.
+//   - Brightness multiplies the brightness, e.g. 0.6 to dim.
+//   - Saturation scales the saturation, where 0 is grayscale.
+//   - Vignette darkens the corners, from 0 to 1.
+//   - Tint is a hex color blended in by TintStrength, from 0 to 1.
+type EffectsConfig struct {
+	Blur         *float64 `yaml:"blur,omitempty"`
+	Brightness   *float64 `yaml:"brightness,omitempty"`
+	Saturation   *float64 `yaml:"saturation,omitempty"`
+	Vignette     *float64 `yaml:"vignette,omitempty"`
+	Tint         string   `yaml:"tint,omitempty"`
+	TintStrength *float64 `yaml:"tint_strength,omitempty"`
+}
+
+// Merge returns the config with any fields set in o replacing its own.
+func (e EffectsConfig) Merge(o EffectsConfig) EffectsConfig {
+	if o.Blur != nil {
+		e.Blur = o.Blur
+	}
+	if o.Brightness != nil {
+		e.Brightness = o.Brightness
+	}
+	if o.Saturation != nil {
+		e.Saturation = o.Saturation
+	}
+	if o.Vignette != nil {
+		e.Vignette = o.Vignette
+	}
+	if o.Tint != "" {
+		e.Tint = o.Tint
+	}
+	if o.TintStrength != nil {
+		e.TintStrength = o.TintStrength
+	}
+
+	return e
+}
+
+// OverlayConfig configures text drawn onto wallpapers. Text is a Go
+// template, e.g. "{{.Hostname}} — {{.Date}}", and there's no overlay if it's
+// empty. Position is one of top-left, top, top-right, left, center, right,
+// bottom-left, bottom or bottom-right. Font is a bundled font (regular, bold,
+// italic, mono or mono-bold) or the path to a TTF or OTF file. Size and
+// Margin are in pixels. Color and Shadow are hex colors, and there's no
+// shadow if Shadow is empty.
+type OverlayConfig struct {
+	Text     string  `yaml:"text,omitempty"`
+	Position string  `yaml:"position,omitempty"`
+	Font     string  `yaml:"font,omitempty"`
+	Size     float64 `yaml:"size,omitempty"`
+	Color    string  `yaml:"color,omitempty"`
+	Shadow   string  `yaml:"shadow,omitempty"`
+	Margin   int     `yaml:"margin,omitempty"`
+}
+
+// Merge returns the config with any fields set in o replacing its own.
+func (c OverlayConfig) Merge(o OverlayConfig) OverlayConfig {
+	if o.Text != "" {
+		c.Text = o.Text
+	}
+	if o.Position != "" {
+		c.Position = o.Position
+	}
+	if o.Font != "" {
+		c.Font = o.Font
+	}
+	if o.Size != 0 {
+		c.Size = o.Size
+	}
+	if o.Color != "" {
+		c.Color = o.Color
+	}
+	if o.Shadow != "" {
+		c.Shadow = o.Shadow
+	}
+	if o.Margin != 0 {
+		c.Margin = o.Margin
+	}
+
+	return c
+}
+
+// CollageConfig configures combining several images into one wallpaper.
+// Count is the number of images, Layout is "grid" or "masonry", Gutter is
+// the space around the images in pixels and Background is the hex color
+// behind them.
+type CollageConfig struct {
+	Enabled    *bool  `yaml:"enabled,omitempty"`
+	Count      int    `yaml:"count,omitempty"`
+	Layout     string `yaml:"layout,omitempty"`
+	Gutter     int    `yaml:"gutter,omitempty"`
+	Background string `yaml:"background,omitempty"`
+}
+
+// IsEnabled returns true if collages are enabled.
+func (c CollageConfig) IsEnabled() bool {
+	return c.Enabled != nil && *c.Enabled
+}
+
+// Merge returns the config with any fields set in o replacing its own.
+func (c CollageConfig) Merge(o CollageConfig) CollageConfig {
+	if o.Enabled != nil {
+		c.Enabled = o.Enabled
+	}
+	if o.Count != 0 {
+		c.Count = o.Count
+	}
+	if o.Layout != "" {
+		c.Layout = o.Layout
+	}
+	if o.Gutter != 0 {
+		c.Gutter = o.Gutter
+	}
+	if o.Background != "" {
+		c.Background = o.Background
+	}
+
+	return c
+}
+
+// TransitionConfig configures the transition shown when the wallpaper
+// changes, for set tools that support them, such as swww. Type is the kind
+// of transition, e.g. "fade", "wipe" or "grow", or "random". Random lists the
+// types to choose from when Type is "random", and without it the tool picks.
+// Duration is in seconds and Angle in degrees. Position is where the
+// transition starts, e.g. "center" or "0.5,0.8", and Bezier is the easing
+// curve as "x1,y1,x2,y2".
+type TransitionConfig struct {
+	Type     string   `yaml:"type,omitempty"`
+	Random   []string `yaml:"random,omitempty"`
+	Duration float64  `yaml:"duration,omitempty"`
+	FPS      int      `yaml:"fps,omitempty"`
+	Step     int      `yaml:"step,omitempty"`
+	Angle    *float64 `yaml:"angle,omitempty"`
+	Position string   `yaml:"position,omitempty"`
+	Bezier   string   `yaml:"bezier,omitempty"`
+}
+
+// Merge returns the config with any fields set in o replacing its own.
+func (t TransitionConfig) Merge(o TransitionConfig) TransitionConfig {
+	if o.Type != "" {
+		t.Type = o.Type
+	}
+	if len(o.Random) > 0 {
+		t.Random = o.Random
+	}
+	if o.Duration != 0 {
+		t.Duration = o.Duration
+	}
+	if o.FPS != 0 {
+		t.FPS = o.FPS
+	}
+	if o.Step != 0 {
+		t.Step = o.Step
+	}
+	if o.Angle != nil {
+		t.Angle = o.Angle
+	}
+	if o.Position != "" {
+		t.Position = o.Position
+	}
+	if o.Bezier != "" {
+		t.Bezier = o.Bezier
+	}
+
+	return t
+}
+
+// ThemeConfig configures generating a color scheme from the wallpaper, in
+// the style of pywal. Display is the display whose wallpaper is used, by
+// index, name or description, and defaults to the first. Light makes a
+// palette with a light background. Each template is rendered with the
+// palette whenever that display's wallpaper changes, then the Reload
+// commands are run so programs pick up the new colors.
+type ThemeConfig struct {
+	Enabled   bool            `yaml:"enabled,omitempty"`
+	Display   string          `yaml:"display,omitempty"`
+	Light     bool            `yaml:"light,omitempty"`
+	Templates []ThemeTemplate `yaml:"templates,omitempty"`
+	Reload    []string        `yaml:"reload,omitempty"`
+}
+
+// ThemeTemplate is a Go template to render with the palette and the file to
+// write it to. Both paths can contain environment variables, e.g.
+// "$HOME/.config/kitty/colors.conf".
+type ThemeTemplate struct {
+	Template string `yaml:"template"`
+	Output   string `yaml:"output"`
+}
+
+// HooksConfig configures commands run when wallpapers change. Each command
+// is run with sh, with the details of the event in WALSH_* environment
+// variables and as JSON on stdin. A failing pre_set command vetoes the image
+// so another is picked. Timeout is how long each command can run, in
+// seconds, and defaults to 10.
+type HooksConfig struct {
+	PreSet      []string `yaml:"pre_set,omitempty"`
+	PostSet     []string `yaml:"post_set,omitempty"`
+	OnBlacklist []string `yaml:"on_blacklist,omitempty"`
+	OnError     []string `yaml:"on_error,omitempty"`
+	Timeout     int      `yaml:"timeout,omitempty"`
+}
+
+// LockscreenConfig configures lock screen images. Each display gets a
+// version of its wallpaper, fitted to it with Effects applied, written to
+// Dir. Swaylock and Hyprlock are the paths of their config files to point
+// at the images, and Greeter is a world-readable path to copy the first
+// display's image to for display manager greeters. With Sources, the lock
+// screen uses its own images, picked by `walsh lockscreen`, instead of
+// following the wallpaper.
+type LockscreenConfig struct {
+	Enabled  bool          `yaml:"enabled,omitempty"`
+	Sources  []string      `yaml:"sources,omitempty"`
+	Effects  EffectsConfig `yaml:"effects,omitempty"`
+	Dir      string        `yaml:"dir,omitempty"`
+	Swaylock string        `yaml:"swaylock,omitempty"`
+	Hyprlock string        `yaml:"hyprlock,omitempty"`
+	Greeter  string        `yaml:"greeter,omitempty"`
+}
+
+// WorkspacesConfig configures a wallpaper per workspace for `walsh
+// workspaces` in Sway, i3 and Hyprland sessions. The wallpaper picked for
+// each workspace on each display is remembered in State and set again when
+// the workspace is shown. Sources maps workspace names to the sources or
+// lists to pick from; other workspaces use the display's sources.
+type WorkspacesConfig struct {
+	State   string              `yaml:"state,omitempty"`
+	Sources map[string][]string `yaml:"sources,omitempty"`
+}
+
+// PhaseConfig is a period of the day with its own effects, e.g. dimming
+// wallpapers at night. Start and End are times in the form "HH:MM". A phase
+// that ends before it starts runs past midnight.
+type PhaseConfig struct {
+	Name    string        `yaml:"name"`
+	Start   string        `yaml:"start"`
+	End     string        `yaml:"end"`
+	Effects EffectsConfig `yaml:"effects,omitempty"`
+	Overlay OverlayConfig `yaml:"overlay,omitempty"`
+	Collage CollageConfig `yaml:"collage,omitempty"`
+}
+
+// Contains returns true if t's time of day is within the phase.
+func (p PhaseConfig) Contains(t time.Time) (bool, error) {
+	start, err := time.Parse("15:04", p.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid start time for phase %s: %w", p.Name, err)
+	}
+
+	end, err := time.Parse("15:04", p.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid end time for phase %s: %w", p.Name, err)
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return now >= from && now < to, nil
+	}
+
+	return now >= from || now < to, nil
+}
+
+// ActivePhase returns the first phase in the schedule containing t.
+func (c Config) ActivePhase(t time.Time) (PhaseConfig, bool) {
+	for _, phase := range c.Schedule {
+		ok, err := phase.Contains(t)
+		if err != nil {
+			log.Warnf("Ignoring phase: %s", err)
+			continue
+		}
+
+		if ok {
+			return phase, true
+		}
+	}
+
+	return PhaseConfig{}, false
+}
+
+// DisplayConfig is configuration for a specific display. Match refers to the
+// display by index, connector name or monitor description. The description
+// is the monitor's make, model and serial, and can be matched by prefix with
+// "desc:", e.g. "desc:Dell Inc. DELL U2720Q".
+type DisplayConfig struct {
+	Match   string        `yaml:"match"`
+	Sources []string      `yaml:"sources,omitempty"`
+	Fit     FitConfig     `yaml:"fit,omitempty"`
+	Effects EffectsConfig `yaml:"effects,omitempty"`
+	Overlay OverlayConfig `yaml:"overlay,omitempty"`
+	Collage CollageConfig `yaml:"collage,omitempty"`
+
+	Transitions TransitionConfig `yaml:"transitions,omitempty"`
 }
 
 type CLIFlags struct {
@@ -143,10 +570,14 @@ func (c Config) createDirs() error {
 }
 
 func defaultConfig() *Config {
+	duplicateThreshold := defaultDuplicateThreshold
+
 	return &Config{
 		BlacklistFile: xdg.ConfigHome + "/walsh/blacklist.json",
+		InvalidFile:   xdg.DataHome + "/walsh/invalid.json",
 		CurrentFile:   xdg.DataHome + "/walsh/current.json",
 		HistoryFile:   xdg.DataHome + "/walsh/history.json",
+		IndexFile:     xdg.DataHome + "/walsh/index.json",
 		ListsDir:      xdg.DataHome + "/walsh/lists",
 		CacheDir:      xdg.CacheHome + "/walsh",
 		DownloadDest:  xdg.Home + "/Pictures/Wallpapers",
@@ -156,6 +587,8 @@ func defaultConfig() *Config {
 		Sources: []string{
 			"dir://" + xdg.Home + "/Pictures/Wallpapers",
 		},
+
+		DuplicateThreshold: &duplicateThreshold,
 	}
 }
 
@@ -180,6 +613,10 @@ func applyDefaults(cfg *Config, defaults *Config) {
 		cfg.BlacklistFile = defaults.BlacklistFile
 	}
 
+	if cfg.InvalidFile == "" {
+		cfg.InvalidFile = defaults.InvalidFile
+	}
+
 	if cfg.CurrentFile == "" {
 		cfg.CurrentFile = defaults.CurrentFile
 	}
@@ -188,6 +625,14 @@ func applyDefaults(cfg *Config, defaults *Config) {
 		cfg.HistoryFile = defaults.HistoryFile
 	}
 
+	if cfg.IndexFile == "" {
+		cfg.IndexFile = defaults.IndexFile
+	}
+
+	if cfg.DuplicateThreshold == nil {
+		cfg.DuplicateThreshold = defaults.DuplicateThreshold
+	}
+
 	if cfg.ListsDir == "" {
 		cfg.ListsDir = defaults.ListsDir
 	}
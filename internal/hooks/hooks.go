@@ -0,0 +1,121 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// The events hooks are run for.
+const (
+	// PreSet runs before an image is set on a display. If a hook fails, the
+	// image is skipped and another is picked.
+	PreSet = "pre_set"
+	// PostSet runs after an image is set on a display.
+	PostSet = "post_set"
+	// Blacklist runs after an image is blacklisted.
+	Blacklist = "on_blacklist"
+	// Error runs when setting the wallpaper fails.
+	Error = "on_error"
+)
+
+// DefaultTimeout is how long a hook can run for if no timeout is
+// configured.
+const DefaultTimeout = 10 * time.Second
+
+// Event describes what a hook is run for. It's written to the hook's stdin
+// as JSON, and its main fields are also set as WALSH_* environment
+// variables.
+type Event struct {
+	Event   string   `json:"event"`
+	Display string   `json:"display,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Source  string   `json:"source,omitempty"`
+	ShaSum  string   `json:"sha,omitempty"`
+	Parts   []string `json:"parts,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// env returns the environment variables for the event.
+func (e Event) env() []string {
+	return []string{
+		"WALSH_EVENT=" + e.Event,
+		"WALSH_DISPLAY=" + e.Display,
+		"WALSH_PATH=" + e.Path,
+		"WALSH_SOURCE=" + e.Source,
+		"WALSH_SHA=" + e.ShaSum,
+		"WALSH_ERROR=" + e.Error,
+	}
+}
+
+// Run runs each hook command with sh in turn, stopping at the first one that
+// fails or runs longer than the timeout.
+func Run(cmds []string, timeout time.Duration, e Event) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		if err = run(cmd, timeout, e, payload); err != nil {
+			return fmt.Errorf("%s hook %q: %w", e.Event, cmd, err)
+		}
+	}
+
+	return nil
+}
+
+// run runs a single hook command.
+func run(cmd string, timeout time.Duration, e Event, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	command := exec.CommandContext(ctx, "sh", "-c", cmd)
+	command.Env = append(os.Environ(), e.env()...)
+	command.Stdin = bytes.NewReader(payload)
+	// Run the hook in its own process group, so a timeout also kills
+	// anything it started, and don't wait for processes it left running with
+	// its output open.
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	command.WaitDelay = time.Second
+
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+
+	log.Debugf("Running %s hook: %s", e.Event, cmd)
+	out, err := command.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if out := strings.TrimSpace(string(out)); out != "" {
+		log.Debugf("%s hook output: %s", e.Event, out)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return err
+	}
+
+	return nil
+}
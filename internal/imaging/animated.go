@@ -0,0 +1,134 @@
+package imaging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// IsAnimated returns true if the file at path is a video, or a GIF or WebP
+// image with more than one frame.
+func IsAnimated(path string) (bool, error) {
+	format, err := SniffFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case IsVideo(format):
+		return true, nil
+	case format == "gif":
+		return gifAnimated(path)
+	case format == "webp":
+		return webpAnimated(path)
+	default:
+		return false, nil
+	}
+}
+
+// gifAnimated walks the blocks of a GIF until it finds a second frame.
+func gifAnimated(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	// The header and logical screen descriptor, then the global color table
+	// if there is one.
+	header := make([]byte, 13)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return false, err
+	}
+	if header[10]&0x80 != 0 {
+		if _, err = r.Discard(3 << (int(header[10]&0x07) + 1)); err != nil {
+			return false, err
+		}
+	}
+
+	frames := 0
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+
+		switch block {
+		case 0x2c: // Image descriptor.
+			frames++
+			if frames > 1 {
+				return true, nil
+			}
+
+			descriptor := make([]byte, 9)
+			if _, err = io.ReadFull(r, descriptor); err != nil {
+				return false, err
+			}
+			if descriptor[8]&0x80 != 0 {
+				if _, err = r.Discard(3 << (int(descriptor[8]&0x07) + 1)); err != nil {
+					return false, err
+				}
+			}
+
+			// The LZW code size, then the image data.
+			if _, err = r.ReadByte(); err != nil {
+				return false, err
+			}
+			if err = skipGIFSubBlocks(r); err != nil {
+				return false, err
+			}
+		case 0x21: // Extension.
+			if _, err = r.ReadByte(); err != nil {
+				return false, err
+			}
+			if err = skipGIFSubBlocks(r); err != nil {
+				return false, err
+			}
+		case 0x3b: // Trailer.
+			return false, nil
+		default:
+			return false, errors.New("invalid GIF block")
+		}
+	}
+}
+
+// skipGIFSubBlocks skips data sub-blocks up to the terminating empty block.
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+
+		if _, err = r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// webpAnimated checks the animation flag of an extended WebP image.
+func webpAnimated(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// RIFF header, then the first chunk, which is VP8X for extended images.
+	header := make([]byte, 21)
+	if _, err = io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	if string(header[12:16]) != "VP8X" || binary.LittleEndian.Uint32(header[16:20]) < 10 {
+		return false, nil
+	}
+
+	return header[20]&0x02 != 0, nil
+}
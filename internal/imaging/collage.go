@@ -0,0 +1,138 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Collage layouts.
+const (
+	// LayoutGrid arranges the images in rows of equal cells.
+	LayoutGrid = "grid"
+	// LayoutMasonry arranges the images in columns, keeping roughly to each
+	// image's aspect ratio.
+	LayoutMasonry = "masonry"
+)
+
+// CollageOptions describes how to arrange images in a collage.
+type CollageOptions struct {
+	Width      int
+	Height     int
+	Layout     string
+	Gutter     int
+	Background color.RGBA
+}
+
+// Collage arranges the images into a single width x height image. Each
+// image is scaled to cover its cell and cropped around its centre.
+func Collage(images []image.Image, o CollageOptions) (image.Image, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images for the collage")
+	}
+
+	var cells []image.Rectangle
+	switch o.Layout {
+	case "", LayoutGrid:
+		cells = gridCells(len(images), o)
+	case LayoutMasonry:
+		cells = masonryCells(images, o)
+	default:
+		return nil, fmt.Errorf("unknown collage layout %q (supported: grid, masonry)", o.Layout)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, o.Width, o.Height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(o.Background), image.Point{}, draw.Src)
+
+	for i, cell := range cells {
+		if cell.Empty() {
+			continue
+		}
+
+		src := CoverRect(images[i].Bounds(), cell.Dx(), cell.Dy(), FocusCenter)
+		draw.CatmullRom.Scale(dst, cell, images[i], src, draw.Src, nil)
+	}
+
+	return dst, nil
+}
+
+// collageColumns returns the number of columns for n images. The grid is
+// kept as square as possible so each cell has the collage's aspect ratio.
+func collageColumns(n int) int {
+	return max(1, int(math.Ceil(math.Sqrt(float64(n)))))
+}
+
+// gridCells lays n cells out in rows. If the last row isn't full, its
+// cells are wider to fill it.
+func gridCells(n int, o CollageOptions) []image.Rectangle {
+	cols := collageColumns(n)
+	rows := (n + cols - 1) / cols
+
+	cells := make([]image.Rectangle, 0, n)
+	for row := 0; row < rows; row++ {
+		inRow := min(cols, n-row*cols)
+		top, bottom := span(row, rows, o.Height, o.Gutter)
+		for col := 0; col < inRow; col++ {
+			left, right := span(col, inRow, o.Width, o.Gutter)
+			cells = append(cells, image.Rect(left, top, right, bottom))
+		}
+	}
+
+	return cells
+}
+
+// masonryCells lays the images out in columns, adding each image to the
+// shortest column at its natural aspect ratio. Each column is then scaled
+// to the full height, so images are cropped a little to fill the gaps.
+func masonryCells(images []image.Image, o CollageOptions) []image.Rectangle {
+	cols := collageColumns(len(images))
+
+	// The images in each column and their heights at unit width.
+	columns := make([][]int, cols)
+	heights := make([]float64, cols)
+	for i, img := range images {
+		shortest := 0
+		for c := range heights {
+			if heights[c] < heights[shortest] {
+				shortest = c
+			}
+		}
+
+		b := img.Bounds()
+		columns[shortest] = append(columns[shortest], i)
+		heights[shortest] += float64(b.Dy()) / float64(max(b.Dx(), 1))
+	}
+
+	cells := make([]image.Rectangle, len(images))
+	for c, column := range columns {
+		left, right := span(c, cols, o.Width, o.Gutter)
+		available := float64(o.Height - o.Gutter*(len(column)+1))
+
+		y := float64(o.Gutter)
+		for j, i := range column {
+			b := images[i].Bounds()
+			h := available * (float64(b.Dy()) / float64(max(b.Dx(), 1))) / heights[c]
+
+			bottom := int(math.Round(y + h))
+			if j == len(column)-1 {
+				bottom = o.Height - o.Gutter
+			}
+			cells[i] = image.Rect(left, int(math.Round(y)), right, bottom)
+			y += h + float64(o.Gutter)
+		}
+	}
+
+	return cells
+}
+
+// span returns the start and end of the ith of n equal parts of length,
+// with gutters between and around them.
+func span(i, n, length, gutter int) (int, int) {
+	size := float64(length-gutter*(n+1)) / float64(n)
+	start := float64(gutter) + float64(i)*(size+float64(gutter))
+
+	return int(math.Round(start)), int(math.Round(start + size))
+}
@@ -0,0 +1,140 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Effects are adjustments applied to an image after it's fitted.
+type Effects struct {
+	// Blur is the blur radius in pixels.
+	Blur float64
+	// Brightness multiplies each channel; 1 leaves the image unchanged.
+	Brightness float64
+	// Saturation scales the color saturation; 0 is grayscale and 1 leaves
+	// the image unchanged.
+	Saturation float64
+	// Vignette darkens the corners, from 0 (none) to 1 (black corners).
+	Vignette float64
+	// Tint is blended into the image by TintStrength, from 0 to 1.
+	Tint         color.RGBA
+	TintStrength float64
+}
+
+// NoEffects leaves an image unchanged.
+var NoEffects = Effects{Brightness: 1, Saturation: 1}
+
+// IsZero returns true if the effects leave an image unchanged.
+func (e Effects) IsZero() bool {
+	return e.Blur <= 0 && e.Brightness == 1 && e.Saturation == 1 &&
+		e.Vignette <= 0 && e.TintStrength <= 0
+}
+
+// applyEffects returns a copy of img with the effects applied.
+func applyEffects(img image.Image, e Effects) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	if e.Blur > 0 {
+		blur(dst, e.Blur)
+	}
+
+	if e.Brightness == 1 && e.Saturation == 1 && e.Vignette <= 0 && e.TintStrength <= 0 {
+		return dst
+	}
+
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	maxDist := math.Hypot(cx, cy)
+	tint := [3]float64{float64(e.Tint.R), float64(e.Tint.G), float64(e.Tint.B)}
+	strength := math.Min(e.TintStrength, 1)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := dst.PixOffset(x, y)
+			px := dst.Pix[i : i+3 : i+3]
+			c := [3]float64{float64(px[0]), float64(px[1]), float64(px[2])}
+
+			// Rec. 601 luma, the gray the saturation moves towards.
+			luma := 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+
+			factor := e.Brightness
+			if e.Vignette > 0 {
+				d := math.Hypot(float64(x)-cx, float64(y)-cy) / maxDist
+				factor *= 1 - math.Min(e.Vignette, 1)*d*d
+			}
+
+			for ch := range c {
+				v := luma + (c[ch]-luma)*e.Saturation
+				if strength > 0 {
+					v += (tint[ch] - v) * strength
+				}
+				px[ch] = clampByte(v * factor)
+			}
+		}
+	}
+
+	return dst
+}
+
+// blur approximates a Gaussian blur of the given radius with three passes of
+// a box blur in each direction.
+func blur(img *image.RGBA, radius float64) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	r := int(math.Round(radius / 2))
+	if r < 1 {
+		r = 1
+	}
+
+	buf := make([]uint8, max(w, h)*4)
+	col := make([]uint8, h*4)
+	for pass := 0; pass < 3; pass++ {
+		for y := 0; y < h; y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+w*4]
+			boxBlur(row, buf, w, 4, r)
+		}
+		for x := 0; x < w; x++ {
+			boxBlurColumn(img, col, buf, x, h, r)
+		}
+	}
+}
+
+// boxBlur blurs n pixels of line, each stride bytes apart, in place.
+func boxBlur(line, buf []uint8, n, stride, r int) {
+	copy(buf, line[:n*stride])
+	window := float64(2*r + 1)
+
+	for ch := 0; ch < 4; ch++ {
+		// Start with the window around the first pixel, repeating the edge.
+		sum := 0
+		for i := -r; i <= r; i++ {
+			sum += int(buf[clamp(i, 0, n-1)*stride+ch])
+		}
+
+		for i := 0; i < n; i++ {
+			line[i*stride+ch] = uint8(float64(sum)/window + 0.5)
+			sum += int(buf[clamp(i+r+1, 0, n-1)*stride+ch]) - int(buf[clamp(i-r, 0, n-1)*stride+ch])
+		}
+	}
+}
+
+// boxBlurColumn blurs column x of img in place, copying it through col.
+func boxBlurColumn(img *image.RGBA, col, buf []uint8, x, h, r int) {
+	for y := 0; y < h; y++ {
+		copy(col[y*4:y*4+4], img.Pix[y*img.Stride+x*4:])
+	}
+
+	boxBlur(col, buf, h, 4, r)
+
+	for y := 0; y < h; y++ {
+		copy(img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4], col[y*4:])
+	}
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,208 @@
+package imaging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Mode is how an image is fitted to a display.
+type Mode string
+
+const (
+	// ModeFill scales the image to cover the display, cropping the edges.
+	ModeFill Mode = "fill"
+	// ModeFit scales the image to fit within the display, letterboxed with
+	// the background color.
+	ModeFit Mode = "fit"
+	// ModeCenter shows the image at its original size in the middle of the
+	// display, cropped or surrounded by the background color.
+	ModeCenter Mode = "center"
+	// ModeTile repeats the image at its original size from the top left.
+	ModeTile Mode = "tile"
+)
+
+// ParseMode parses a fit mode name. An empty name or "none" returns an
+// empty mode, meaning the image isn't fitted.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "", "none":
+		return "", nil
+	case ModeFill, ModeFit, ModeCenter, ModeTile:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown fit mode %q (supported: fill, fit, center, tile)", name)
+	}
+}
+
+// Focus is the point of an image to keep in view when cropping, as a
+// fraction of its width and height from the top left.
+type Focus struct {
+	X, Y float64
+}
+
+// FocusCenter is the middle of the image.
+var FocusCenter = Focus{X: 0.5, Y: 0.5}
+
+// focusNames are the named focus points.
+var focusNames = map[string]Focus{
+	"center":       FocusCenter,
+	"top":          {0.5, 0},
+	"bottom":       {0.5, 1},
+	"left":         {0, 0.5},
+	"right":        {1, 0.5},
+	"top-left":     {0, 0},
+	"top-right":    {1, 0},
+	"bottom-left":  {0, 1},
+	"bottom-right": {1, 1},
+}
+
+// ParseFocus parses a focus point, either a name such as "top" or
+// "bottom-left", or "x,y" fractions such as "0.5,0.3". An empty string is the
+// centre.
+func ParseFocus(s string) (Focus, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return FocusCenter, nil
+	}
+
+	if focus, ok := focusNames[s]; ok {
+		return focus, nil
+	}
+
+	xs, ys, found := strings.Cut(s, ",")
+	if found {
+		x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+		if errX == nil && errY == nil && x >= 0 && x <= 1 && y >= 0 && y <= 1 {
+			return Focus{X: x, Y: y}, nil
+		}
+	}
+
+	return Focus{}, fmt.Errorf("invalid focus %q: use a name such as \"top\" or \"x,y\" between 0 and 1", s)
+}
+
+// ParseColor parses a hex color in the form "#rgb" or "#rrggbb". An empty
+// string is black.
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if s == "" {
+		return color.RGBA{A: 0xff}, nil
+	}
+
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: use #rgb or #rrggbb", s)
+	}
+
+	return color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xff}, nil
+}
+
+// Options describes how to process an image for a display.
+type Options struct {
+	Width      int
+	Height     int
+	Mode       Mode
+	Background color.RGBA
+	Focus      Focus
+	Effects    Effects
+	Overlay    Overlay
+}
+
+// Enabled returns true if the options change the image.
+func (o Options) Enabled() bool {
+	return o.fits() || !o.Effects.IsZero() || o.Overlay.Text != ""
+}
+
+// fits returns true if the image is fitted to a known size.
+func (o Options) fits() bool {
+	return o.Mode != "" && o.Width > 0 && o.Height > 0
+}
+
+// Key returns a string identifying the options, for naming cached results.
+// It starts with the size and mode, or "orig" if the image isn't fitted,
+// followed by a hash of the remaining parameters.
+func (o Options) Key() string {
+	if !o.fits() {
+		o = Options{Effects: o.Effects, Overlay: o.Overlay}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", o)))
+
+		return "orig-" + hex.EncodeToString(sum[:4])
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", o)))
+
+	return fmt.Sprintf("%dx%d-%s-%s", o.Width, o.Height, o.Mode, hex.EncodeToString(sum[:4]))
+}
+
+// Process returns the image fitted to the size in the options, with the
+// effects applied and the overlay drawn on top.
+func Process(img image.Image, o Options) (image.Image, error) {
+	if o.fits() {
+		img = fit(img, o)
+	}
+
+	if !o.Effects.IsZero() {
+		img = applyEffects(img, o.Effects)
+	}
+
+	if o.Overlay.Text != "" {
+		return drawOverlay(img, o.Overlay)
+	}
+
+	return img, nil
+}
+
+// fit fits an image to o.Width x o.Height according to the mode.
+func fit(img image.Image, o Options) image.Image {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return img
+	}
+
+	if o.Mode == ModeFill {
+		return Resize(img, CoverRect(bounds, o.Width, o.Height, o.Focus), o.Width, o.Height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, o.Width, o.Height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(o.Background), image.Point{}, draw.Src)
+
+	switch o.Mode {
+	case ModeFit:
+		w, h := o.Width, bounds.Dy()*o.Width/bounds.Dx()
+		if h > o.Height {
+			w, h = bounds.Dx()*o.Height/bounds.Dy(), o.Height
+		}
+		r := image.Rect(0, 0, w, h).Add(image.Pt((o.Width-w)/2, (o.Height-h)/2))
+		draw.CatmullRom.Scale(dst, r, img, bounds, draw.Over, nil)
+	case ModeCenter:
+		// Offset the image so the focus point lines up with the centre of
+		// the display when the image is larger than it.
+		offset := image.Pt((o.Width-bounds.Dx())/2, (o.Height-bounds.Dy())/2)
+		if bounds.Dx() > o.Width {
+			offset.X = -clamp(int(o.Focus.X*float64(bounds.Dx()))-o.Width/2, 0, bounds.Dx()-o.Width)
+		}
+		if bounds.Dy() > o.Height {
+			offset.Y = -clamp(int(o.Focus.Y*float64(bounds.Dy()))-o.Height/2, 0, bounds.Dy()-o.Height)
+		}
+		draw.Draw(dst, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Over)
+	case ModeTile:
+		for y := 0; y < o.Height; y += bounds.Dy() {
+			for x := 0; x < o.Width; x += bounds.Dx() {
+				draw.Draw(dst, bounds.Sub(bounds.Min).Add(image.Pt(x, y)), img, bounds.Min, draw.Over)
+			}
+		}
+	}
+
+	return dst
+}
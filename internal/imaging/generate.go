@@ -0,0 +1,299 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// Generator describes a procedurally generated wallpaper, parsed from a
+// source such as "gen://gradient?colors=#1e1e2e,#89b4fa&seed=42".
+type Generator struct {
+	// Kind is one of solid, gradient, noise or pattern. An empty kind
+	// picks one at random.
+	Kind string
+	// Colors is the palette. If it's empty, one is made from the seed.
+	Colors []color.RGBA
+	// Seed makes the output reproducible. Without one, every image is
+	// different.
+	Seed    int64
+	HasSeed bool
+	// Shape is the pattern's shape: stripes, checker, dots or triangles. An
+	// empty shape picks one at random.
+	Shape string
+	// Angle is the gradient's angle in degrees. Without one it's random.
+	Angle    float64
+	HasAngle bool
+}
+
+// generatorKinds are the kinds of generated wallpapers.
+var generatorKinds = []string{"solid", "gradient", "noise", "pattern"}
+
+// patternShapes are the shapes of the pattern generator.
+var patternShapes = []string{"stripes", "checker", "dots", "triangles"}
+
+// ParseGenerator parses a gen:// source.
+func ParseGenerator(src string) (Generator, error) {
+	spec, ok := strings.CutPrefix(src, "gen://")
+	if !ok {
+		return Generator{}, fmt.Errorf("not a generated source: %s", src)
+	}
+
+	kind, rawQuery, _ := strings.Cut(spec, "?")
+	g := Generator{Kind: strings.ToLower(strings.Trim(kind, "/"))}
+	if g.Kind == "random" {
+		g.Kind = ""
+	}
+	if g.Kind != "" && !util.Contains(generatorKinds, g.Kind) {
+		return Generator{}, fmt.Errorf("unknown generator %q (supported: %s)",
+			g.Kind, strings.Join(generatorKinds, ", "))
+	}
+
+	// Parse the query on its own rather than the whole source as a URL, so
+	// colors can be written with a leading '#'.
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Generator{}, fmt.Errorf("invalid generator options %q: %w", rawQuery, err)
+	}
+
+	for _, c := range strings.Split(query.Get("colors"), ",") {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+
+		parsed, err := ParseColor(c)
+		if err != nil {
+			return Generator{}, err
+		}
+		g.Colors = append(g.Colors, parsed)
+	}
+
+	if seed := query.Get("seed"); seed != "" {
+		if g.Seed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			return Generator{}, fmt.Errorf("invalid seed %q: %w", seed, err)
+		}
+		g.HasSeed = true
+	}
+
+	g.Shape = strings.ToLower(query.Get("shape"))
+	if g.Shape != "" && !util.Contains(patternShapes, g.Shape) {
+		return Generator{}, fmt.Errorf("unknown pattern shape %q (supported: %s)",
+			g.Shape, strings.Join(patternShapes, ", "))
+	}
+
+	if angle := query.Get("angle"); angle != "" {
+		if g.Angle, err = strconv.ParseFloat(angle, 64); err != nil {
+			return Generator{}, fmt.Errorf("invalid angle %q: %w", angle, err)
+		}
+		g.HasAngle = true
+	}
+
+	return g, nil
+}
+
+// Generate renders a width x height image. Unset options are chosen with a
+// random number generator seeded with g.Seed, so the same generator always
+// renders the same image.
+func (g Generator) Generate(width, height int) image.Image {
+	rng := rand.New(rand.NewSource(g.Seed)) // #nosec G404
+
+	kind := g.Kind
+	if kind == "" {
+		kind = generatorKinds[rng.Intn(len(generatorKinds))]
+	}
+
+	colors := g.Colors
+	if len(colors) == 0 {
+		colors = randomPalette(rng)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	switch kind {
+	case "solid":
+		fillFunc(img, func(_, _ int) color.RGBA { return colors[0] })
+	case "gradient":
+		angle := g.Angle
+		if !g.HasAngle {
+			angle = rng.Float64() * 360
+		}
+		drawGradient(img, colors, angle)
+	case "noise":
+		drawNoise(img, colors, rng)
+	case "pattern":
+		shape := g.Shape
+		if shape == "" {
+			shape = patternShapes[rng.Intn(len(patternShapes))]
+		}
+		drawPattern(img, colors, shape, rng)
+	}
+
+	return img
+}
+
+// randomPalette returns three colors with nearby hues.
+func randomPalette(rng *rand.Rand) []color.RGBA {
+	hue := rng.Float64() * 360
+	colors := make([]color.RGBA, 3)
+	for i := range colors {
+		colors[i] = hsv(math.Mod(hue+float64(i)*30, 360), 0.4+rng.Float64()*0.4, 0.25+float64(i)*0.25)
+	}
+
+	return colors
+}
+
+// hsv converts a hue (0-360), saturation and value (0-1) to a color.
+func hsv(h, s, v float64) color.RGBA {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{
+		R: clampByte((r + m) * 255),
+		G: clampByte((g + m) * 255),
+		B: clampByte((b + m) * 255),
+		A: 0xff,
+	}
+}
+
+// fillFunc sets every pixel of img to the color returned by f.
+func fillFunc(img *image.RGBA, f func(x, y int) color.RGBA) {
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.SetRGBA(x, y, f(x, y))
+		}
+	}
+}
+
+// blend returns the color at t (0-1) along a gradient through colors.
+func blend(colors []color.RGBA, t float64) color.RGBA {
+	if len(colors) == 1 {
+		return colors[0]
+	}
+
+	t = math.Max(0, math.Min(1, t)) * float64(len(colors)-1)
+	i := min(int(t), len(colors)-2)
+	f := t - float64(i)
+	a, b := colors[i], colors[i+1]
+
+	return color.RGBA{
+		R: clampByte(float64(a.R) + (float64(b.R)-float64(a.R))*f),
+		G: clampByte(float64(a.G) + (float64(b.G)-float64(a.G))*f),
+		B: clampByte(float64(a.B) + (float64(b.B)-float64(a.B))*f),
+		A: 0xff,
+	}
+}
+
+// drawGradient draws a linear gradient through colors at the given angle.
+func drawGradient(img *image.RGBA, colors []color.RGBA, angle float64) {
+	w, h := float64(img.Rect.Dx()), float64(img.Rect.Dy())
+	dx, dy := math.Cos(angle*math.Pi/180), math.Sin(angle*math.Pi/180)
+
+	// Project the corners onto the gradient's direction to find its extent.
+	extent := math.Abs(w*dx) + math.Abs(h*dy)
+	fillFunc(img, func(x, y int) color.RGBA {
+		p := (float64(x)-w/2)*dx + (float64(y)-h/2)*dy
+
+		return blend(colors, p/extent+0.5)
+	})
+}
+
+// drawNoise draws smooth value noise mapped onto the palette.
+func drawNoise(img *image.RGBA, colors []color.RGBA, rng *rand.Rand) {
+	const gridSize = 64
+	grid := make([]float64, gridSize*gridSize)
+	for i := range grid {
+		grid[i] = rng.Float64()
+	}
+
+	sample := func(x, y float64) float64 {
+		x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+		fx, fy := smoothstep(x-float64(x0)), smoothstep(y-float64(y0))
+		at := func(i, j int) float64 {
+			return grid[((j%gridSize+gridSize)%gridSize)*gridSize+(i%gridSize+gridSize)%gridSize]
+		}
+		top := at(x0, y0) + (at(x0+1, y0)-at(x0, y0))*fx
+		bottom := at(x0, y0+1) + (at(x0+1, y0+1)-at(x0, y0+1))*fx
+
+		return top + (bottom-top)*fy
+	}
+
+	scale := 4 / float64(max(img.Rect.Dx(), img.Rect.Dy()))
+	fillFunc(img, func(x, y int) color.RGBA {
+		v, amplitude, frequency, total := 0.0, 1.0, 1.0, 0.0
+		for octave := 0; octave < 4; octave++ {
+			v += sample(float64(x)*scale*frequency, float64(y)*scale*frequency) * amplitude
+			total += amplitude
+			amplitude /= 2
+			frequency *= 2
+		}
+
+		return blend(colors, v/total)
+	})
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// drawPattern draws a geometric pattern in the palette's colors.
+func drawPattern(img *image.RGBA, colors []color.RGBA, shape string, rng *rand.Rand) {
+	cell := max(img.Rect.Dx(), img.Rect.Dy()) / (8 + rng.Intn(16))
+	cell = max(cell, 1)
+	pick := func(i int) color.RGBA { return colors[(i%len(colors)+len(colors))%len(colors)] }
+
+	switch shape {
+	case "stripes":
+		fillFunc(img, func(x, y int) color.RGBA { return pick((x + y) / cell) })
+	case "checker":
+		fillFunc(img, func(x, y int) color.RGBA { return pick(x/cell + y/cell) })
+	case "dots":
+		radius := float64(cell) * 0.3
+		fillFunc(img, func(x, y int) color.RGBA {
+			cx, cy := float64(x%cell)-float64(cell)/2, float64(y%cell)-float64(cell)/2
+			if math.Hypot(cx, cy) <= radius {
+				return pick(1 + x/cell + y/cell)
+			}
+
+			return colors[0]
+		})
+	case "triangles":
+		// Each cell is split along its diagonal into two triangles with
+		// colors chosen at random.
+		cols, rows := img.Rect.Dx()/cell+1, img.Rect.Dy()/cell+1
+		fills := make([]int, cols*rows*2)
+		for i := range fills {
+			fills[i] = rng.Intn(len(colors))
+		}
+		fillFunc(img, func(x, y int) color.RGBA {
+			i := ((y/cell)*cols + x/cell) * 2
+			if x%cell > y%cell {
+				i++
+			}
+
+			return colors[fills[i]]
+		})
+	}
+}
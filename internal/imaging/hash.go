@@ -0,0 +1,39 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// DHash returns the difference hash of an image: the image is shrunk to 9x8
+// gray pixels and each bit is set if a pixel is brighter than the one to its
+// right. Resized and recompressed copies of an image have the same or a very
+// similar hash.
+func DHash(img image.Image) uint64 {
+	small := Resize(img, img.Bounds(), 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luma(small, x, y) > luma(small, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// HashDistance returns the number of bits that differ between two hashes.
+// Copies of the same image are usually within 5 or so.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// luma returns the Rec. 601 luma of a pixel.
+func luma(img image.Image, x, y int) float64 {
+	r, g, b, _ := img.At(x, y).RGBA()
+
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
@@ -0,0 +1,105 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshbeard/walsh/internal/util"
+
+	// Register decoders for the formats walsh reads.
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// jpegQuality is the quality used when writing JPEG images.
+const jpegQuality = 95
+
+// Load decodes the image at path.
+func Load(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// Save encodes an image to path. The format is chosen by the file
+// extension: PNG for .png and JPEG otherwise. The image is written to a
+// temporary file and renamed into place, so a reader never sees it
+// half-written.
+func Save(img image.Image, path string) error {
+	tmp, err := util.TempPath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Resize scales the region r of img to width x height.
+func Resize(img image.Image, r image.Rectangle, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, r, draw.Src, nil)
+
+	return dst
+}
+
+// CoverRect returns the largest region of bounds with the aspect ratio of
+// width x height, positioned so the focus point is as close to its centre as
+// possible. Scaling that region to width x height fills the whole area
+// without distorting the image.
+func CoverRect(bounds image.Rectangle, width, height int, focus Focus) image.Rectangle {
+	bw, bh := bounds.Dx(), bounds.Dy()
+
+	// Compare bw/bh with width/height without floating point.
+	cw, ch := bw, bh
+	if bw*height > bh*width {
+		cw = bh * width / height
+	} else {
+		ch = bw * height / width
+	}
+
+	x := bounds.Min.X + clamp(int(focus.X*float64(bw))-cw/2, 0, bw-cw)
+	y := bounds.Min.Y + clamp(int(focus.Y*float64(bh))-ch/2, 0, bh-ch)
+
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,189 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Overlay is text drawn onto an image.
+type Overlay struct {
+	// Text is the text to draw. Lines are separated by newlines.
+	Text string
+	// Position is where the text is anchored, e.g. "bottom-right".
+	Position string
+	// Font is the name of a bundled font or the path to a TTF or OTF file.
+	Font string
+	// Size is the font size in pixels.
+	Size float64
+	// Margin is the distance from the edges of the image in pixels.
+	Margin int
+	Color  color.RGBA
+	// Shadow is drawn behind the text, offset by a tenth of the font size,
+	// if its alpha isn't zero.
+	Shadow color.RGBA
+}
+
+// bundledFonts are the fonts that can be used by name.
+var bundledFonts = map[string][]byte{
+	"regular":   goregular.TTF,
+	"bold":      gobold.TTF,
+	"italic":    goitalic.TTF,
+	"mono":      gomono.TTF,
+	"mono-bold": gomonobold.TTF,
+}
+
+var (
+	fontsMu sync.Mutex
+	fonts   = map[string]*opentype.Font{}
+)
+
+// loadFont returns the bundled font with the given name, or the font in the
+// file at that path. An empty name is the regular font.
+func loadFont(name string) (*opentype.Font, error) {
+	if name == "" {
+		name = "regular"
+	}
+
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+
+	if f, ok := fonts[name]; ok {
+		return f, nil
+	}
+
+	data, ok := bundledFonts[name]
+	if !ok {
+		var err error
+		data, err = os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font %s: %w", name, err)
+		}
+	}
+
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", name, err)
+	}
+	fonts[name] = f
+
+	return f, nil
+}
+
+// drawOverlay returns a copy of img with the overlay text drawn on it.
+func drawOverlay(img image.Image, o Overlay) (image.Image, error) {
+	horizontal, vertical, err := overlayAnchor(o.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := loadFont(o.Font)
+	if err != nil {
+		return nil, err
+	}
+
+	size := o.Size
+	if size <= 0 {
+		size = 24
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size: size, DPI: 72, Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	lines := strings.Split(strings.TrimRight(o.Text, "\n"), "\n")
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	blockHeight := lineHeight * len(lines)
+
+	top := o.Margin
+	switch vertical {
+	case "center":
+		top = (dst.Rect.Dy() - blockHeight) / 2
+	case "bottom":
+		top = dst.Rect.Dy() - o.Margin - blockHeight
+	}
+
+	shadow := int(size/10) + 1
+	for i, line := range lines {
+		width := font.MeasureString(face, line).Ceil()
+		left := o.Margin
+		switch horizontal {
+		case "center":
+			left = (dst.Rect.Dx() - width) / 2
+		case "right":
+			left = dst.Rect.Dx() - o.Margin - width
+		}
+
+		baseline := top + i*lineHeight + metrics.Ascent.Ceil()
+		if o.Shadow.A > 0 {
+			drawText(dst, face, line, left+shadow, baseline+shadow, o.Shadow)
+		}
+		drawText(dst, face, line, left, baseline, o.Color)
+	}
+
+	return dst, nil
+}
+
+// drawText draws a line of text with its baseline starting at x, y.
+func drawText(dst draw.Image, face font.Face, text string, x, y int, c color.RGBA) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// overlayAnchors are the horizontal and vertical alignment of each overlay
+// position.
+var overlayAnchors = map[string][2]string{
+	"top-left":     {"left", "top"},
+	"top":          {"center", "top"},
+	"top-right":    {"right", "top"},
+	"left":         {"left", "center"},
+	"center":       {"center", "center"},
+	"right":        {"right", "center"},
+	"bottom-left":  {"left", "bottom"},
+	"bottom":       {"center", "bottom"},
+	"bottom-right": {"right", "bottom"},
+}
+
+// overlayAnchor returns the horizontal (left, center, right) and vertical
+// (top, center, bottom) alignment for a position such as "bottom-right". An
+// empty position is the bottom right.
+func overlayAnchor(position string) (string, string, error) {
+	position = strings.ToLower(strings.TrimSpace(position))
+	if position == "" {
+		position = "bottom-right"
+	}
+
+	anchor, ok := overlayAnchors[position]
+	if !ok {
+		return "", "", fmt.Errorf("unknown overlay position %q", position)
+	}
+
+	return anchor[0], anchor[1], nil
+}
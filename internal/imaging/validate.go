@@ -0,0 +1,210 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatSignatures are the leading bytes of each image format.
+var formatSignatures = []struct {
+	format    string
+	signature string
+}{
+	{"jpeg", "\xff\xd8\xff"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF87a"},
+	{"gif", "GIF89a"},
+	{"bmp", "BM"},
+	{"tiff", "II*\x00"},
+	{"tiff", "MM\x00*"},
+}
+
+// heifBrands are the ISO media file brands of AVIF and HEIC images.
+var heifBrands = map[string]string{
+	"avif": "avif",
+	"avis": "avif",
+	"heic": "heic",
+	"heix": "heic",
+	"hevc": "heic",
+	"hevx": "heic",
+	"heim": "heic",
+	"heis": "heic",
+	"mif1": "heic",
+	"msf1": "heic",
+}
+
+// videoBrands are the ISO media file brands of MP4 and QuickTime videos.
+var videoBrands = map[string]bool{
+	"isom": true,
+	"iso2": true,
+	"iso3": true,
+	"iso4": true,
+	"iso5": true,
+	"iso6": true,
+	"mp41": true,
+	"mp42": true,
+	"avc1": true,
+	"M4V ": true,
+	"qt  ": true,
+}
+
+// formatExtensions are the file extensions of each image format.
+var formatExtensions = map[string][]string{
+	"jpeg": {".jpg", ".jpeg"},
+	"png":  {".png"},
+	"gif":  {".gif"},
+	"bmp":  {".bmp"},
+	"tiff": {".tif", ".tiff"},
+	"webp": {".webp"},
+	"avif": {".avif"},
+	"heic": {".heic", ".heif"},
+	"svg":  {".svg"},
+	"mp4":  {".mp4", ".m4v", ".mov"},
+	"webm": {".webm"},
+	"mkv":  {".mkv"},
+}
+
+// decodableFormats are the formats walsh can decode itself. Others have to
+// be converted with an external tool first.
+var decodableFormats = []string{"jpeg", "png", "gif", "bmp", "tiff", "webp"}
+
+// videoFormats are the video formats that can be used as wallpapers.
+var videoFormats = []string{"mp4", "webm", "mkv"}
+
+// Sniff returns the image format of data from its leading bytes, or an empty
+// string if it isn't a known image format.
+func Sniff(data []byte) string {
+	for _, s := range formatSignatures {
+		if bytes.HasPrefix(data, []byte(s.signature)) {
+			return s.format
+		}
+	}
+
+	if len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return "webp"
+	}
+
+	// AVIF, HEIC and MP4 are all ISO media files, told apart by their brand.
+	// Other brands, such as audio-only M4A, aren't wallpapers.
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		brand := string(data[8:12])
+		if format, ok := heifBrands[brand]; ok {
+			return format
+		}
+		if videoBrands[brand] {
+			return "mp4"
+		}
+
+		return ""
+	}
+
+	// WebM and Matroska are EBML files, told apart by their doctype.
+	if bytes.HasPrefix(data, []byte("\x1a\x45\xdf\xa3")) {
+		switch {
+		case bytes.Contains(data, []byte("webm")):
+			return "webm"
+		case bytes.Contains(data, []byte("matroska")):
+			return "mkv"
+		}
+
+		return ""
+	}
+
+	// SVG is XML, so look for the root element near the start.
+	text := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if (bytes.HasPrefix(text, []byte("<?xml")) || bytes.HasPrefix(text, []byte("<!")) ||
+		bytes.HasPrefix(text, []byte("<svg"))) && bytes.Contains(text, []byte("<svg")) {
+		return "svg"
+	}
+
+	return ""
+}
+
+// SniffFile returns the image format of the file at path from its contents,
+// or an empty string if it isn't a known image format.
+func SniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return Sniff(header[:n]), nil
+}
+
+// Decodable returns true if walsh can decode images in the format.
+func Decodable(format string) bool {
+	for _, f := range decodableFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsVideo returns true if the format is a video format.
+func IsVideo(format string) bool {
+	for _, f := range videoFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsImageExtension returns true if path has the extension of a known image
+// or video format.
+func IsImageExtension(path string) bool {
+	for format := range formatExtensions {
+		if MatchesExtension(path, format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesExtension returns true if the file extension of path is one used
+// for the format.
+func MatchesExtension(path, format string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range formatExtensions[format] {
+		if e == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify decodes the whole image at path to make sure it's readable.
+func Verify(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("the file is truncated")
+		}
+
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// AnimationProvider is implemented by session providers that can play
+// animated images and videos as wallpapers. Other providers, and formats a
+// provider can't play, get the first frame as a still wallpaper.
+type AnimationProvider interface {
+	// AnimatedFormats returns the formats, as named by imaging.Sniff, that
+	// can be played. It's empty if no player is installed.
+	AnimatedFormats() []string
+
+	// SetAnimatedWallpaper plays the animated image or video at path on
+	// the display.
+	SetAnimatedWallpaper(path string, display Display) error
+}
+
+// defaultWaylandAnimatedCmds are the players for animated wallpapers in
+// Wayland sessions.
+var defaultWaylandAnimatedCmds = []string{
+	`mpvpaper -o 'no-audio loop panscan=1.0' '{{display}}' '{{path}}'`,
+}
+
+// defaultXorgAnimatedCmds are the players for animated wallpapers in Xorg
+// sessions. {{geometry}} is replaced with the display's area, as
+// WIDTHxHEIGHT+X+Y.
+var defaultXorgAnimatedCmds = []string{
+	`xwinwrap -g {{geometry}} -ov -ni -s -nf -b -un -- mpv -wid WID --loop --no-audio --no-osc --no-osd-bar --panscan=1.0 '{{path}}'`,
+}
+
+// animatedFormats are the formats the players can play.
+var animatedFormats = []string{"gif", "webp", "mp4", "webm", "mkv"}
+
+// animatedPlayers are the commands of the players, which keep running to
+// draw the wallpaper.
+var animatedPlayers = []string{"mpvpaper", "xwinwrap"}
+
+// motionFormat returns the format of the file at path if it's a video or an
+// animated image, or an empty string if it's a still image.
+func motionFormat(path string) string {
+	animated, err := imaging.IsAnimated(path)
+	if err != nil || !animated {
+		return ""
+	}
+
+	format, err := imaging.SniffFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return format
+}
+
+// animator returns the session's provider if it can play the file at path.
+func (s Session) animator(path string) (AnimationProvider, bool) {
+	p, ok := s.svc.(AnimationProvider)
+	if !ok {
+		return nil, false
+	}
+
+	format := motionFormat(path)
+	if format == "" || !util.Contains(p.AnimatedFormats(), format) {
+		return nil, false
+	}
+
+	return p, true
+}
+
+// setDisplayWallpaper sets the image at path on a display. Animated images
+// and videos are played if the provider can, and otherwise, or if the
+// player fails, their first frame is set.
+func (s Session) setDisplayWallpaper(path string, d Display) error {
+	if p, ok := s.animator(path); ok {
+		err := p.SetAnimatedWallpaper(path, d)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Error playing wallpaper on display %s, setting its first frame: %s", d.Name, err)
+	}
+
+	if err := s.svc.SetWallpaper(s.prepareWallpaper(path, d), d); err != nil {
+		return err
+	}
+	stopAnimated(d.Name)
+
+	return nil
+}
+
+// playAnimated plays the animated images and videos in paths, keyed by
+// display name, on the displays that have just been set to their first
+// frame by a batch, and stops the players on the other displays.
+func (s Session) playAnimated(displays []Display, paths map[string]string) {
+	for _, d := range displays {
+		p, ok := s.animator(paths[d.Name])
+		if !ok {
+			stopAnimated(d.Name)
+			continue
+		}
+
+		if err := p.SetAnimatedWallpaper(paths[d.Name], d); err != nil {
+			log.Warnf("Error playing wallpaper on display %s, keeping its first frame: %s", d.Name, err)
+			stopAnimated(d.Name)
+		}
+	}
+}
+
+// stopAnimated stops the players started for a display, once a still
+// wallpaper has been set on it.
+func stopAnimated(display string) {
+	for _, name := range animatedPlayers {
+		pidFile, err := xdg.RuntimeFile(pidFileName(name, display))
+		if err != nil || !util.FileExists(pidFile) {
+			continue
+		}
+
+		stopPIDFile(pidFile, name)
+		if err = os.Remove(pidFile); err != nil {
+			log.Warnf("Error removing PID file %s: %s", pidFile, err)
+		}
+	}
+}
+
+// playerFormats returns the formats the first available player in cmds can
+// play. xwinwrap needs mpv to draw in the window it creates.
+func playerFormats(cmds []string) []string {
+	cmd, err := findSetCmd(cmds, "")
+	if err != nil {
+		return nil
+	}
+
+	if cmdName(cmd) == "xwinwrap" {
+		if _, err = exec.LookPath("mpv"); err != nil {
+			return nil
+		}
+	}
+
+	return animatedFormats
+}
+
+// waylandAnimatedFormats returns the formats that can be played in a
+// Wayland session. swww plays GIFs itself.
+func waylandAnimatedFormats(cfg *config.Config) []string {
+	formats := playerFormats(defaultWaylandAnimatedCmds)
+	if waylandSetTool(cfg) == "swww" && !util.Contains(formats, "gif") {
+		formats = append(formats, "gif")
+	}
+
+	return formats
+}
+
+// setWaylandAnimated plays an animated image or video on a display with
+// mpvpaper. GIFs are left to swww when it's the set tool, since it plays
+// them without another process.
+func setWaylandAnimated(path string, display Display, cfg *config.Config) error {
+	if waylandSetTool(cfg) == "swww" {
+		if format, _ := imaging.SniffFile(path); format == "gif" {
+			if err := setWaylandWallpaper(path, display, cfg); err != nil {
+				return err
+			}
+			stopAnimated(display.Name)
+
+			return nil
+		}
+	}
+
+	cmd, err := getSetCmd(defaultWaylandAnimatedCmds, path, display.Name, "")
+	if err != nil {
+		return fmt.Errorf("error getting animated wallpaper command: %w", err)
+	}
+
+	if err = runSetCmd(cmd, display.Name); err != nil {
+		return fmt.Errorf("error playing wallpaper: %w", err)
+	}
+
+	return nil
+}
+
+// waylandSetTool returns the name of the tool used to set still wallpapers
+// in a Wayland session, or an empty string for a custom set command.
+func waylandSetTool(cfg *config.Config) string {
+	if cfg.SetCommand != "" {
+		return ""
+	}
+
+	_, tool := cfg.SessionOverride()
+	cmd, err := findSetCmd(defaultWaylandSetCmds, tool)
+	if err != nil {
+		return ""
+	}
+
+	return cmdName(cmd)
+}
+
+// setXorgAnimated plays an animated image or video on a display with mpv in
+// a desktop window created by xwinwrap, covering the display's area.
+func setXorgAnimated(path string, display Display) error {
+	if display.Width <= 0 || display.Height <= 0 {
+		return fmt.Errorf("the size of display %s is unknown", display.Name)
+	}
+
+	cmd, err := getSetCmd(defaultXorgAnimatedCmds, path, display.Name, "")
+	if err != nil {
+		return fmt.Errorf("error getting animated wallpaper command: %w", err)
+	}
+	cmd = strings.ReplaceAll(cmd, "{{geometry}}", fmt.Sprintf("%dx%d%+d%+d",
+		display.Width, display.Height, display.X, display.Y))
+
+	if err = runSetCmd(cmd, display.Name); err != nil {
+		return fmt.Errorf("error playing wallpaper: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// BatchSetter is implemented by session providers that can set the
+// wallpaper on several displays at once. Tools like feh replace the
+// wallpaper on every monitor with each invocation, so setting displays one
+// at a time would overwrite the previous ones.
+type BatchSetter interface {
+	// SetWallpapers sets the wallpapers given as a map of display name to
+	// image path.
+	SetWallpapers(paths map[string]string) error
+}
+
+// SharedSetter is implemented by batch providers whose set tool may draw a
+// single image on every display, such as wbg. Every display is then given
+// the same image.
+type SharedSetter interface {
+	// SharesImage returns true if the set tool draws one image on every
+	// display.
+	SharesImage() bool
+}
+
+// errNotPerDisplay is returned when the set tool can only show one image on
+// every display, but the displays are given different ones. Retrying won't
+// help.
+var errNotPerDisplay = errors.New("the set tool draws the same image on every display")
+
+// sortedDisplayNames returns the display names in paths, ordered
+// numerically for head indices and alphabetically otherwise.
+func sortedDisplayNames(paths map[string]string) []string {
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, errA := strconv.Atoi(names[i])
+		b, errB := strconv.Atoi(names[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// setEach sets the wallpapers one display at a time, in display order.
+func setEach(paths map[string]string, set func(path, display string) error) error {
+	for _, name := range sortedDisplayNames(paths) {
+		if err := set(paths[name], name); err != nil {
+			return fmt.Errorf("display %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setAllOutputs sets the wallpaper with a tool that draws a single image on
+// every output, such as wbg. It's run once, so it can only set one display,
+// or several showing the same image.
+func setAllOutputs(tool string, paths map[string]string, set func(path, display string) error) error {
+	names := sortedDisplayNames(paths)
+	if len(names) == 0 {
+		return nil
+	}
+
+	path := paths[names[0]]
+	for _, name := range names[1:] {
+		if paths[name] != path {
+			return fmt.Errorf("%s: %w; use swww or swaybg instead", tool, errNotPerDisplay)
+		}
+	}
+
+	return set(path, names[0])
+}
+
+// fehBatchCmd returns a single feh command that sets an image on every
+// Xinerama head. feh assigns the images to heads in order, so this only
+// works if paths has an image for each head from 0 up.
+func fehBatchCmd(paths map[string]string) (string, bool) {
+	names := sortedDisplayNames(paths)
+
+	images := make([]string, 0, len(names))
+	for i, name := range names {
+		if name != strconv.Itoa(i) {
+			return "", false
+		}
+		images = append(images, "'"+paths[name]+"'")
+	}
+
+	return "feh --bg-fill " + strings.Join(images, " "), true
+}
+
+// swwwBatchCmds returns one swww command per image and transition, each
+// covering all of the displays that show that image with that transition.
+func swwwBatchCmds(
+	tmpl string, paths map[string]string, transitions map[string]config.TransitionConfig,
+) []string {
+	type group struct{ path, args string }
+
+	outputs := map[group][]string{}
+	order := []group{}
+	for _, name := range sortedDisplayNames(paths) {
+		// Random types are picked per display, so displays showing the same
+		// image may end up in separate commands.
+		g := group{path: paths[name], args: strings.Join(swwwTransitionArgs(transitions[name]), " ")}
+		if _, ok := outputs[g]; !ok {
+			order = append(order, g)
+		}
+		outputs[g] = append(outputs[g], name)
+	}
+
+	cmds := make([]string, 0, len(order))
+	for _, g := range order {
+		cmd := parseSetCmd(tmpl, g.path, strings.Join(outputs[g], ","))
+		if g.args != "" {
+			cmd += " " + g.args
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds
+}
+
+// runBatchCmds runs each command in turn.
+func runBatchCmds(cmds []string) error {
+	for _, cmd := range cmds {
+		if _, err := util.RunCmd(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/hooks"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// defaultCollageCount is the number of images in a collage if it isn't
+// configured.
+const defaultCollageCount = 4
+
+// collageSource is the source recorded for collages.
+const collageSource = "collage"
+
+// collageConfig returns the collage config for a display, from the global
+// config overridden by the display's config and then the active schedule
+// phase's.
+func (s Session) collageConfig(d Display) config.CollageConfig {
+	cfg := s.cfg.Collage.Merge(s.DisplayConfig(d).Collage)
+	if phase, ok := s.cfg.ActivePhase(time.Now()); ok {
+		cfg = cfg.Merge(phase.Collage)
+	}
+
+	return cfg
+}
+
+// pickImage selects an image for a display from its pool, or makes a
+// collage of several if collages are enabled for it. Images vetoed by the
+// pre_set hooks are discarded and another is picked.
+func (s *Session) pickImage(pools *imagePools, d Display) (source.Image, error) {
+	for vetoes := 0; ; vetoes++ {
+		image, err := s.pickCandidate(pools, d)
+		if err != nil {
+			return image, err
+		}
+
+		err = s.runHooks(hooks.PreSet, d.Name, image, nil)
+		if err == nil {
+			return image, nil
+		}
+		if vetoes >= MaxRetries {
+			return source.Image{}, fmt.Errorf("too many images vetoed for display %s: %w", d.Name, err)
+		}
+
+		log.Infof("Skipping %s for display %s: %s", image.Path, d.Name, err)
+		for _, img := range image.Images() {
+			pools.discard(d, img)
+		}
+	}
+}
+
+// pickCandidate selects an image or makes a collage for a display, before
+// the pre_set hooks are run.
+func (s *Session) pickCandidate(pools *imagePools, d Display) (source.Image, error) {
+	cfg := s.collageConfig(d)
+	if !cfg.IsEnabled() {
+		return s.pickFromPool(pools, d)
+	}
+
+	return s.pickCollage(pools, d, cfg)
+}
+
+// pickFromPool selects an image for a display from its pool, skipping and
+// discarding any that can't be set or are near-duplicates of images already
+// chosen. If only near-duplicates are left, the first one is used.
+func (s *Session) pickFromPool(pools *imagePools, d Display) (source.Image, error) {
+	var duplicate *source.Image
+	for {
+		image, err := s.pickValid(
+			func() (source.Image, error) { return pools.pick(d) },
+			func(image source.Image) { pools.discard(d, image) },
+		)
+		if errors.Is(err, errNoImages) && duplicate != nil {
+			log.Debugf("Only near-duplicates are left for display %s", d.Name)
+			return *duplicate, nil
+		}
+		if err != nil || pools.claim(d, image) {
+			return image, err
+		}
+
+		log.Debugf("Skipping %s for display %s: it's a near-duplicate of another wallpaper",
+			image.Path, d.Name)
+		if duplicate == nil {
+			duplicate = &image
+		}
+		pools.discard(d, image)
+	}
+}
+
+// pickCollage selects images for a display and combines them into a
+// collage in the cache directory. The images it's made from are kept as its
+// parts, so they can be recorded and blacklisted individually.
+func (s *Session) pickCollage(pools *imagePools, d Display, cfg config.CollageConfig) (source.Image, error) {
+	count := cfg.Count
+	if count <= 0 {
+		count = defaultCollageCount
+	}
+
+	var parts []source.Image
+	seen := map[string]bool{}
+	for tries := 0; len(parts) < count && tries < count*3; tries++ {
+		part, err := s.pickFromPool(pools, d)
+		if err != nil {
+			return source.Image{}, err
+		}
+
+		if seen[part.ShaSum] {
+			continue
+		}
+		seen[part.ShaSum] = true
+		parts = append(parts, part)
+	}
+
+	if len(parts) < count {
+		log.Warnf("Only found %d of %d images for the collage on display %s", len(parts), count, d.Name)
+	}
+
+	width, height := d.Width, d.Height
+	if width <= 0 || height <= 0 {
+		width, height = 1920, 1080
+	}
+
+	background, err := imaging.ParseColor(cfg.Background)
+	if err != nil {
+		return source.Image{}, err
+	}
+
+	opts := imaging.CollageOptions{
+		Width:      width,
+		Height:     height,
+		Layout:     strings.ToLower(cfg.Layout),
+		Gutter:     cfg.Gutter,
+		Background: background,
+	}
+
+	key := []string{fmt.Sprintf("%+v", opts)}
+	for _, part := range parts {
+		key = append(key, part.ShaSum)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(key, "\n")))
+	dest := filepath.Join(s.cfg.CacheDir,
+		fmt.Sprintf("walsh-collage-%s-%dx%d.jpg", hex.EncodeToString(sum[:8]), width, height))
+
+	if !util.FileExists(dest) {
+		images := make([]image.Image, 0, len(parts))
+		for _, part := range parts {
+			path, err := s.decodableImage(part.Path, width, height)
+			if err != nil {
+				return source.Image{}, err
+			}
+
+			img, err := imaging.Load(path)
+			if err != nil {
+				return source.Image{}, err
+			}
+			images = append(images, img)
+		}
+
+		collage, err := imaging.Collage(images, opts)
+		if err != nil {
+			return source.Image{}, err
+		}
+
+		if err = imaging.Save(collage, dest); err != nil {
+			return source.Image{}, err
+		}
+	}
+
+	checksum, err := util.Sha256(dest)
+	if err != nil {
+		return source.Image{}, err
+	}
+
+	return source.Image{Source: collageSource, Path: dest, ShaSum: checksum, Parts: parts}, nil
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// converters are the commands tried, in order, to convert images walsh
+// can't decode to PNG. Videos and animated WebP images are converted to
+// their first frame. These values are replaced:
+//   - {{input}}: the path to the image
+//   - {{output}}: the path to write the PNG to
+//   - {{width}} and {{height}}: the size to rasterize SVG images at
+var converters = map[string][]string{
+	"avif": {
+		`avifdec '{{input}}' '{{output}}'`,
+		`heif-convert '{{input}}' '{{output}}'`,
+		`magick '{{input}}' '{{output}}'`,
+		`convert '{{input}}' '{{output}}'`,
+	},
+	"heic": {
+		`heif-convert '{{input}}' '{{output}}'`,
+		`magick '{{input}}' '{{output}}'`,
+		`convert '{{input}}' '{{output}}'`,
+	},
+	"svg": {
+		`rsvg-convert --width {{width}} --height {{height}} --keep-aspect-ratio --output '{{output}}' '{{input}}'`,
+		`magick -background none '{{input}}' -resize {{width}}x{{height}} '{{output}}'`,
+		`inkscape --export-type=png --export-width={{width}} --export-filename='{{output}}' '{{input}}'`,
+	},
+	"mp4":  firstFrameConverters,
+	"webm": firstFrameConverters,
+	"mkv":  firstFrameConverters,
+	"webp-animated": {
+		`magick '{{input}}[0]' '{{output}}'`,
+		`convert '{{input}}[0]' '{{output}}'`,
+		`ffmpeg -y -loglevel error -i '{{input}}' -frames:v 1 '{{output}}'`,
+	},
+}
+
+// firstFrameConverters extract the first frame of a video.
+var firstFrameConverters = []string{
+	`ffmpeg -y -loglevel error -i '{{input}}' -frames:v 1 '{{output}}'`,
+	`magick '{{input}}[0]' '{{output}}'`,
+}
+
+// convertWallpaper returns the path to a version of the image the session's
+// set tool can display. Images walsh can't decode are converted to PNG by
+// decodableImage, and images in other formats the tool can't display are
+// re-encoded in the cache directory.
+func (s Session) convertWallpaper(path string, width, height int) (string, error) {
+	path, err := s.decodableImage(path, width, height)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := imaging.SniffFile(path)
+	if err != nil {
+		return "", err
+	}
+	if format == "" || util.Contains(s.nativeFormats(), format) {
+		return path, nil
+	}
+
+	log.Debugf("Converting %s image %s, the set tool can't display it", format, path)
+
+	return s.processImage(path, imaging.Options{})
+}
+
+// decodableImage returns the path to a version of the image walsh can
+// decode. AVIF and HEIC images, and the first frame of videos and animated
+// WebP images, are converted to PNG in the cache directory with an external
+// tool, and SVG images are rasterized to fit width x height.
+func (s Session) decodableImage(path string, width, height int) (string, error) {
+	format, err := imaging.SniffFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// The WebP decoder only reads still images.
+	if format == "webp" {
+		if animated, _ := imaging.IsAnimated(path); animated {
+			format = "webp-animated"
+		}
+	}
+	if format == "" || imaging.Decodable(format) {
+		return path, nil
+	}
+
+	cmds, ok := converters[format]
+	if !ok {
+		return "", fmt.Errorf("can't convert %s images", format)
+	}
+
+	if width <= 0 || height <= 0 {
+		width, height = 1920, 1080
+	}
+
+	hash, err := util.Sha256(path)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("walsh-%s.png", hash[:16])
+	if format == "svg" {
+		name = fmt.Sprintf("walsh-%s-%dx%d.png", hash[:16], width, height)
+	}
+	dest := filepath.Join(s.cfg.CacheDir, name)
+	if util.FileExists(dest) {
+		log.Debugf("Using converted image %s", dest)
+		return dest, nil
+	}
+
+	tools := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		tools = append(tools, cmdName(cmd))
+		if _, err := exec.LookPath(cmdName(cmd)); err != nil {
+			continue
+		}
+
+		// Convert to a temporary file and rename it into place, so a
+		// conversion running at the same time never hands over a
+		// half-written image.
+		tmp, err := util.TempPath(dest)
+		if err != nil {
+			return "", err
+		}
+
+		cmd = strings.NewReplacer(
+			"{{input}}", path,
+			"{{output}}", tmp,
+			"{{width}}", strconv.Itoa(width),
+			"{{height}}", strconv.Itoa(height),
+		).Replace(cmd)
+
+		if out, err := util.RunCmd(cmd); err != nil {
+			os.Remove(tmp)
+			return "", fmt.Errorf("failed to convert %s: %w: %s", path, err, out)
+		}
+		if err = os.Rename(tmp, dest); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		log.Debugf("Converted %s image %s to %s", format, path, dest)
+
+		return dest, nil
+	}
+
+	return "", fmt.Errorf("can't convert %s image %s: install one of %s",
+		format, path, strings.Join(tools, ", "))
+}
@@ -0,0 +1,230 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// errNoCustomBackend is returned when the custom session is selected without
+// a backend configured.
+var errNoCustomBackend = errors.New(
+	"the custom session needs backend.list_displays and backend.set to be configured",
+)
+
+// custom is a session backend defined entirely by commands in the config.
+type custom struct {
+	cfg *config.Config
+}
+
+var _ SessionProvider = &custom{}
+
+func NewCustom(cfg *config.Config) SessionProvider {
+	return &custom{cfg: cfg}
+}
+
+// detectCustom returns true if a custom backend is configured and its detect
+// command succeeds.
+func detectCustom(cfg *config.Config) bool {
+	if !cfg.Backend.Enabled() {
+		return false
+	}
+
+	if cfg.Backend.Detect == "" {
+		return true
+	}
+
+	if _, err := util.RunCmd(cfg.Backend.Detect); err != nil {
+		log.Debugf("Custom backend not detected: %s", err)
+		return false
+	}
+
+	return true
+}
+
+// parseDisplayCmd replaces the display placeholders in a command.
+func parseDisplayCmd(cmd string, display Display) string {
+	cmd = strings.ReplaceAll(cmd, "{{display}}", display.Name)
+	cmd = strings.ReplaceAll(cmd, "{{index}}", strconv.Itoa(display.Index))
+
+	return cmd
+}
+
+// SetWallpaper runs the backend's set command.
+func (c custom) SetWallpaper(path string, display Display) error {
+	cmd := parseDisplayCmd(strings.ReplaceAll(c.cfg.Backend.Set, "{{path}}", path), display)
+	if err := runSetCmd(cmd, display.Name); err != nil {
+		return fmt.Errorf("error setting wallpaper: %w", err)
+	}
+
+	return nil
+}
+
+// GetDisplays runs the backend's list_displays command and parses the
+// display names from its output.
+func (c custom) GetDisplays() ([]Display, error) {
+	output, err := util.RunCmd(c.cfg.Backend.ListDisplays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list displays: %w", err)
+	}
+
+	var names []string
+	switch c.cfg.Backend.Parser {
+	case "", "lines":
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				names = append(names, line)
+			}
+		}
+	case "json":
+		names, err = jsonPathStrings(output, c.cfg.Backend.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown display parser: %s", c.cfg.Backend.Parser)
+	}
+
+	displays := make([]Display, 0, len(names))
+	for i, name := range names {
+		displays = append(displays, Display{Index: i, Name: name})
+	}
+
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
+}
+
+// GetCurrentWallpaper runs the backend's get_current command, or returns the
+// last wallpaper walsh set if there isn't one.
+func (c custom) GetCurrentWallpaper(display, current Display) (string, error) {
+	if c.cfg.Backend.GetCurrent == "" {
+		if current.Current.Path == "" {
+			return "", fmt.Errorf("no wallpaper found for display %s", display.Name)
+		}
+
+		return current.Current.Path, nil
+	}
+
+	output, err := util.RunCmd(parseDisplayCmd(c.cfg.Backend.GetCurrent, display))
+	if err != nil {
+		return "", fmt.Errorf("failed to get current wallpaper: %w", err)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// jsonPathStrings evaluates a simple JSONPath expression against a JSON
+// document and returns the matching string values. Supported are object keys
+// separated by dots, array indices ("[0]") and wildcards ("[*]" or "*"),
+// which select every array element or object value. A leading "$" is
+// optional, e.g. "$.outputs[*].name" or "[*].name".
+func jsonPathStrings(data, path string) ([]string, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	nodes := []interface{}{doc}
+	for _, step := range jsonPathSteps(path) {
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, jsonPathStep(node, step)...)
+		}
+		nodes = next
+	}
+
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		switch v := node.(type) {
+		case string:
+			values = append(values, v)
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("JSON path %q selects a non-string value", path)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("JSON path %q matched nothing", path)
+	}
+
+	return values, nil
+}
+
+// jsonPathSteps splits a JSONPath expression into keys, indices and
+// wildcards. Indices and wildcards are returned in brackets.
+func jsonPathSteps(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	var steps []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open == -1 {
+				steps = append(steps, part)
+				break
+			}
+
+			if open > 0 {
+				steps = append(steps, part[:open])
+			}
+
+			end := strings.Index(part[open:], "]")
+			if end == -1 {
+				steps = append(steps, part[open:])
+				break
+			}
+
+			steps = append(steps, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+	}
+
+	return steps
+}
+
+// jsonPathStep applies a single step to a node.
+func jsonPathStep(node interface{}, step string) []interface{} {
+	switch {
+	case step == "*" || step == "[*]":
+		switch v := node.(type) {
+		case []interface{}:
+			return v
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			values := make([]interface{}, 0, len(v))
+			for _, key := range keys {
+				values = append(values, v[key])
+			}
+
+			return values
+		}
+	case strings.HasPrefix(step, "["):
+		i, err := strconv.Atoi(strings.Trim(step, "[]"))
+		if v, ok := node.([]interface{}); ok && err == nil && i >= 0 && i < len(v) {
+			return []interface{}{v[i]}
+		}
+	default:
+		if v, ok := node.(map[string]interface{}); ok {
+			if value, exists := v[step]; exists {
+				return []interface{}{value}
+			}
+		}
+	}
+
+	return nil
+}
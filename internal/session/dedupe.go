@@ -0,0 +1,169 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+)
+
+// Duplicate is an image in a group of duplicates.
+type Duplicate struct {
+	source.Image
+	Width  int
+	Height int
+	// Distance is the number of bits its hash differs from the best copy's.
+	Distance int
+	// Removable is true if the image can be deleted or blacklisted in
+	// favour of the best copy: it's another file, and identical to the best
+	// copy or within the threshold of it. Groups are joined through any
+	// pair of near-duplicates, so some members may be further away.
+	Removable bool
+}
+
+// Exact returns true if the image is byte for byte the same as other.
+func (d Duplicate) Exact(other Duplicate) bool {
+	return d.ShaSum == other.ShaSum
+}
+
+// DuplicateGroup is a set of images that are copies of each other. The first
+// image is the best copy: the one with the most pixels, then the largest
+// file.
+type DuplicateGroup []Duplicate
+
+// FindDuplicates returns the groups of identical and near-duplicate images in
+// the sources. Images are near-duplicates if their hashes differ by at most
+// threshold bits; a negative threshold only finds identical files. If no
+// sources are given, the configured sources, the displays' sources and the
+// fallback sources are searched. Files listed by more than one source are
+// only included once, and images from SSH sources and generated sources are
+// skipped.
+func (s Session) FindDuplicates(sources []string, threshold int) ([]DuplicateGroup, error) {
+	if len(sources) == 0 {
+		sources = s.allSources()
+	}
+
+	all, err := source.GetImages(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	index := loadIndex(s.cfg.IndexFile)
+	var images []Duplicate
+	var hashes []uint64
+	for _, image := range source.UniqueImages(all) {
+		if image.Path == "" || source.IsGenerated(image) {
+			continue
+		}
+
+		entry, err := index.lookup(image)
+		if err != nil {
+			log.Warnf("Skipping %s: %s", image.Path, err)
+			continue
+		}
+		hash, err := index.hash(image)
+		if err != nil {
+			log.Warnf("Skipping %s: %s", image.Path, err)
+			continue
+		}
+
+		images = append(images, Duplicate{Image: image, Width: entry.Width, Height: entry.Height})
+		hashes = append(hashes, hash)
+	}
+
+	if err = index.save(); err != nil {
+		log.Errorf("Error saving image index: %s", err)
+	}
+
+	// Join duplicates into groups with a union-find.
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if images[i].ShaSum == images[j].ShaSum ||
+				(threshold >= 0 && imaging.HashDistance(hashes[i], hashes[j]) <= threshold) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]int{}
+	var roots []int
+	for i := range images {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+
+	var groups []DuplicateGroup
+	for _, root := range roots {
+		if len(members[root]) < 2 {
+			continue
+		}
+
+		idx := members[root]
+		sort.SliceStable(idx, func(a, b int) bool {
+			return betterCopy(images[idx[a]], images[idx[b]])
+		})
+
+		best := images[idx[0]]
+		group := make(DuplicateGroup, 0, len(idx))
+		for n, i := range idx {
+			dup := images[i]
+			dup.Distance = imaging.HashDistance(hashes[idx[0]], hashes[i])
+			dup.Removable = n > 0 && !sameFile(dup.Path, best.Path) &&
+				(dup.Exact(best) || dup.Distance <= threshold)
+			group = append(group, dup)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// betterCopy returns true if a is a better copy to keep than b: it has more
+// pixels, or the same and a larger file.
+func betterCopy(a, b Duplicate) bool {
+	if pa, pb := a.Width*a.Height, b.Width*b.Height; pa != pb {
+		return pa > pb
+	}
+
+	return fileSize(a.Path) > fileSize(b.Path)
+}
+
+// sameFile returns true if a and b are the same file, by path or through a
+// link.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// dedupeFixture writes an image file for each name with the given contents
+// and indexes it with the given hash and size, so FindDuplicates doesn't
+// have to decode it. It returns the session and the directory of images.
+func dedupeFixture(t *testing.T, files map[string]string, entries map[string]indexEntry) (Session, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	pics := filepath.Join(dir, "pics")
+	if err := os.Mkdir(pics, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	index := map[string]indexEntry{}
+	for name, content := range files {
+		path := filepath.Join(pics, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		sum, err := util.Sha256(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index[sum] = entries[content]
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(dir, "index.json")
+	if err = os.WriteFile(indexFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return Session{cfg: &config.Config{IndexFile: indexFile}}, pics
+}
+
+// removable returns the base names of a group's removable copies.
+func removable(group DuplicateGroup) []string {
+	var names []string
+	for _, dup := range group {
+		if dup.Removable {
+			names = append(names, filepath.Base(dup.Path))
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestFindDuplicatesOverlappingSources(t *testing.T) {
+	s, pics := dedupeFixture(t,
+		map[string]string{"a.png": "a", "b.png": "b"},
+		map[string]indexEntry{
+			"a": {DHash: "0", Width: 100, Height: 100},
+			"b": {DHash: "ffffffff", Width: 100, Height: 100},
+		},
+	)
+
+	// The list names a file that's also in the directory, with an unclean
+	// path.
+	list := filepath.Join(t.TempDir(), "fav.txt")
+	if err := os.WriteFile(list, []byte(pics+"/./a.png\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := s.FindDuplicates([]string{"dir://" + pics, "list://" + list}, 6)
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("got %d groups, want none: %+v", len(groups), groups)
+	}
+}
+
+func TestFindDuplicatesChain(t *testing.T) {
+	// b is 4 bits from a and c is 4 bits from b, but 8 from a.
+	s, pics := dedupeFixture(t,
+		map[string]string{"a.png": "a", "copy.png": "a", "b.png": "b", "c.png": "c"},
+		map[string]indexEntry{
+			"a": {DHash: "0", Width: 200, Height: 200},
+			"b": {DHash: "f", Width: 100, Height: 100},
+			"c": {DHash: "ff", Width: 100, Height: 100},
+		},
+	)
+
+	groups, err := s.FindDuplicates([]string{"dir://" + pics}, 4)
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1: %+v", len(groups), groups)
+	}
+
+	group := groups[0]
+	if len(group) != 4 {
+		t.Fatalf("got %d images in the group, want 4", len(group))
+	}
+	if best := filepath.Base(group[0].Path); best != "a.png" && best != "copy.png" {
+		t.Errorf("best copy = %s, want a.png or copy.png", best)
+	}
+	if group[0].Removable {
+		t.Error("the best copy is removable")
+	}
+
+	want := []string{"b.png"}
+	if filepath.Base(group[0].Path) == "a.png" {
+		want = append(want, "copy.png")
+	} else {
+		want = append([]string{"a.png"}, want...)
+	}
+	sort.Strings(want)
+
+	if got := removable(group); !reflect.DeepEqual(got, want) {
+		t.Errorf("removable = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"strconv"
+	"strings"
+)
+
+// descPrefix prefixes a display reference that matches the start of a
+// monitor's description, e.g. "desc:Dell Inc. DELL U2720Q".
+const descPrefix = "desc:"
+
+// Description returns the monitor's make, model and serial separated by
+// spaces, or an empty string if none are known.
+func (d Display) Description() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{d.Make, d.Model, d.Serial} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// ID returns a stable identifier for the display. This is the monitor's
+// description when known, so it survives connector and ordering changes, and
+// the connector name otherwise. Without a serial, identical monitors would
+// share a description, so the connector name is added to tell them apart.
+func (d Display) ID() string {
+	desc := d.Description()
+	switch {
+	case desc == "":
+		return d.Name
+	case d.Serial == "":
+		return desc + " " + d.Name
+	default:
+		return desc
+	}
+}
+
+// MatchesDescription returns true if ref matches the monitor's description,
+// either exactly or as a prefix when written as "desc:<prefix>". The
+// comparison is case-insensitive.
+func (d Display) MatchesDescription(ref string) bool {
+	desc := strings.ToLower(d.Description())
+	if desc == "" {
+		return false
+	}
+
+	ref = strings.ToLower(ref)
+	if prefix, ok := strings.CutPrefix(ref, descPrefix); ok {
+		return prefix != "" && strings.HasPrefix(desc, strings.TrimSpace(prefix))
+	}
+
+	return desc == ref
+}
+
+// Matches returns true if ref refers to the display by index, name or
+// description.
+func (d Display) Matches(ref string) bool {
+	return ref == strconv.Itoa(d.Index) || ref == d.Name || d.MatchesDescription(ref)
+}
+
+// transformNames maps the transform names used by sway and wlr-randr to
+// wl_output transform values.
+var transformNames = map[string]int{
+	"normal":      0,
+	"90":          1,
+	"180":         2,
+	"270":         3,
+	"flipped":     4,
+	"flipped-90":  5,
+	"flipped-180": 6,
+	"flipped-270": 7,
+}
+
+// unknownToEmpty returns an empty string for the placeholder values some
+// compositors report when an EDID field isn't available.
+func unknownToEmpty(s string) string {
+	if strings.EqualFold(s, "unknown") {
+		return ""
+	}
+
+	return s
+}
+
+// fillFromEDID fills in any missing make, model or serial from the EDID in
+// /sys/class/drm for the display's connector.
+func fillFromEDID(displays []Display) {
+	for i, d := range displays {
+		if d.Make != "" && d.Model != "" {
+			continue
+		}
+
+		info, err := sysfsEDID(d.Name)
+		if err != nil {
+			continue
+		}
+
+		displays[i].Make, displays[i].Model, displays[i].Serial = info.Make, info.Model, info.Serial
+	}
+}
@@ -0,0 +1,90 @@
+package session
+
+import "testing"
+
+func TestDisplayID(t *testing.T) {
+	tests := []struct {
+		name    string
+		display Display
+		want    string
+	}{
+		{
+			name:    "no description",
+			display: Display{Name: "HDMI-A-1"},
+			want:    "HDMI-A-1",
+		},
+		{
+			name:    "make, model and serial",
+			display: Display{Name: "DP-1", Make: "Dell Inc.", Model: "U2720Q", Serial: "ABC123"},
+			want:    "Dell Inc. U2720Q ABC123",
+		},
+		{
+			name:    "no serial",
+			display: Display{Name: "DP-2", Make: "Dell Inc.", Model: "U2720Q"},
+			want:    "Dell Inc. U2720Q DP-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.display.ID(); got != tt.want {
+				t.Errorf("ID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWallpaperForDisplay(t *testing.T) {
+	current := CurrentWallpaper{Displays: []Display{
+		{Index: 0, Name: "DP-1"},
+		{Index: 1, Name: "DP-2", Make: "Dell Inc.", Model: "U2720Q"},
+		{Index: 2, Name: "DP-3", Make: "Dell Inc.", Model: "U2720Q"},
+		{Index: 3, Name: "eDP-1", Make: "BOE", Model: "0x095F", Serial: "42"},
+	}}
+
+	tests := []struct {
+		name     string
+		display  Display
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "identical monitors are told apart",
+			display:  Display{Name: "DP-3", Make: "Dell Inc.", Model: "U2720Q"},
+			wantName: "DP-3",
+		},
+		{
+			name:     "serial survives a connector change",
+			display:  Display{Name: "eDP-2", Make: "BOE", Model: "0x095F", Serial: "42"},
+			wantName: "eDP-1",
+		},
+		{
+			name:     "old entry matched by name",
+			display:  Display{Name: "DP-1", Make: "LG", Model: "27UK850", Serial: "7"},
+			wantName: "DP-1",
+		},
+		{
+			name:    "unknown display",
+			display: Display{Name: "HDMI-A-1", Make: "LG", Model: "27UK850", Serial: "7"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := current.ForDisplay(tt.display)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForDisplay: %v", err)
+			}
+			if got.Name != tt.wantName {
+				t.Errorf("matched %s, want %s", got.Name, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package session
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// edidHeader is the fixed 8-byte header of an EDID base block.
+var edidHeader = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// edidInfo is the identifying information parsed from a monitor's EDID.
+type edidInfo struct {
+	Make   string
+	Model  string
+	Serial string
+}
+
+// parseEDID parses the manufacturer, model name and serial number from an
+// EDID base block. The make is the three-letter PNP manufacturer ID. The
+// model and serial come from the display descriptors when present, otherwise
+// from the numeric product code and serial number.
+func parseEDID(data []byte) (edidInfo, error) {
+	if len(data) < 128 || string(data[:8]) != string(edidHeader) {
+		return edidInfo{}, errors.New("invalid EDID")
+	}
+
+	var info edidInfo
+
+	// Bytes 8-9: three 5-bit letters, 'A' = 1.
+	id := binary.BigEndian.Uint16(data[8:10])
+	info.Make = string([]byte{
+		byte('A' - 1 + (id>>10)&0x1f),
+		byte('A' - 1 + (id>>5)&0x1f),
+		byte('A' - 1 + id&0x1f),
+	})
+
+	// Four 18-byte descriptors start at byte 54. Display descriptors have a
+	// zero pixel clock, followed by a tag byte at offset 3.
+	for offset := 54; offset+18 <= 126; offset += 18 {
+		desc := data[offset : offset+18]
+		if desc[0] != 0 || desc[1] != 0 {
+			continue
+		}
+
+		text := strings.TrimSpace(strings.SplitN(string(desc[5:]), "\n", 2)[0])
+		switch desc[3] {
+		case 0xfc:
+			info.Model = text
+		case 0xff:
+			info.Serial = text
+		}
+	}
+
+	if info.Model == "" {
+		info.Model = "0x" + strconv.FormatUint(uint64(binary.LittleEndian.Uint16(data[10:12])), 16)
+	}
+
+	if serial := binary.LittleEndian.Uint32(data[12:16]); info.Serial == "" && serial != 0 {
+		info.Serial = strconv.FormatUint(uint64(serial), 10)
+	}
+
+	return info, nil
+}
+
+// sysfsEDID returns the EDID information for a connector from
+// /sys/class/drm, where connectors are named e.g. card0-DP-3.
+func sysfsEDID(connector string) (edidInfo, error) {
+	matches, err := filepath.Glob("/sys/class/drm/card*-" + connector + "/edid")
+	if err != nil || len(matches) == 0 {
+		return edidInfo{}, errors.New("no EDID found for " + connector)
+	}
+
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		return edidInfo{}, err
+	}
+
+	return parseEDID(data)
+}
+
+// xrandrEDIDs returns the EDID information for each connected output as
+// reported by `xrandr --props`, keyed by output name.
+func xrandrEDIDs() (map[string]edidInfo, error) {
+	output, err := util.RunCmd("xrandr --props")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseXrandrEDIDs(output), nil
+}
+
+// parseXrandrEDIDs parses the hex-encoded EDID blocks in the output of
+// `xrandr --props`.
+func parseXrandrEDIDs(output string) map[string]edidInfo {
+	infos := map[string]edidInfo{}
+
+	var connector, hexData string
+	inEDID := false
+	flush := func() {
+		if connector != "" && hexData != "" {
+			if data, err := hex.DecodeString(hexData); err == nil {
+				if info, err := parseEDID(data); err == nil {
+					infos[connector] = info
+				}
+			}
+		}
+		hexData = ""
+		inEDID = false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"):
+			// An output line, e.g. "DP-1 connected primary 2560x1440+0+0 ...".
+			flush()
+			connector = ""
+			if fields := strings.Fields(line); len(fields) > 1 && fields[1] == "connected" {
+				connector = fields[0]
+			}
+		case strings.HasPrefix(trimmed, "EDID:"):
+			flush()
+			inEDID = true
+		case inEDID && isHex(trimmed):
+			hexData += trimmed
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return infos
+}
+
+// isHex returns true if s is a non-empty string of hex digits.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+
+	return err == nil && len(s)%2 == 0
+}
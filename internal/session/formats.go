@@ -0,0 +1,59 @@
+package session
+
+import (
+	"github.com/joshbeard/walsh/internal/config"
+)
+
+// FormatProvider is implemented by session providers that know which image
+// formats their tool can display. Images in other formats are converted to
+// PNG or JPEG before they're set.
+type FormatProvider interface {
+	// Formats returns the image formats, as named by imaging.Sniff, that can
+	// be set without converting them.
+	Formats() []string
+}
+
+// defaultFormats are the formats assumed to work with providers that don't
+// implement FormatProvider, and with custom set commands.
+var defaultFormats = []string{"jpeg", "png"}
+
+// toolFormats are the image formats each set tool can display.
+var toolFormats = map[string][]string{
+	"nitrogen":   {"jpeg", "png", "gif", "bmp", "tiff"},
+	"feh":        {"jpeg", "png", "gif", "bmp", "tiff"},
+	"xwallpaper": {"jpeg", "png"},
+	"xsetbg":     {"jpeg", "png", "gif", "bmp", "tiff"},
+	"swww":       {"jpeg", "png", "gif", "bmp", "tiff", "webp"},
+	"swaybg":     {"jpeg", "png", "gif", "bmp", "tiff"},
+	"wbg":        {"jpeg", "png", "webp"},
+}
+
+// setToolFormats returns the formats of the tool that would be picked from
+// the set commands, or the default formats if a custom set command is
+// configured or the tool isn't known.
+func setToolFormats(cmds []string, cfg *config.Config) []string {
+	if cfg.SetCommand != "" {
+		return defaultFormats
+	}
+
+	_, tool := cfg.SessionOverride()
+	cmd, err := findSetCmd(cmds, tool)
+	if err != nil {
+		return defaultFormats
+	}
+
+	if formats, ok := toolFormats[cmdName(cmd)]; ok {
+		return formats
+	}
+
+	return defaultFormats
+}
+
+// nativeFormats returns the image formats the session's provider can set.
+func (s Session) nativeFormats() []string {
+	if p, ok := s.svc.(FormatProvider); ok {
+		return p.Formats()
+	}
+
+	return defaultFormats
+}
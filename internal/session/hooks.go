@@ -0,0 +1,70 @@
+package session
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/hooks"
+	"github.com/joshbeard/walsh/internal/source"
+)
+
+// hookCmds returns the commands configured for a hook event.
+func (s Session) hookCmds(event string) []string {
+	switch event {
+	case hooks.PreSet:
+		return s.cfg.Hooks.PreSet
+	case hooks.PostSet:
+		return s.cfg.Hooks.PostSet
+	case hooks.Blacklist:
+		return s.cfg.Hooks.OnBlacklist
+	case hooks.Error:
+		return s.cfg.Hooks.OnError
+	default:
+		return nil
+	}
+}
+
+// runHooks runs the hooks for an event about an image on a display. Either
+// may be empty, e.g. for errors that aren't about a single display. failure
+// is the error for on_error hooks.
+func (s Session) runHooks(event, display string, image source.Image, failure error) error {
+	cmds := s.hookCmds(event)
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	e := hooks.Event{
+		Event:   event,
+		Display: display,
+		Path:    image.Path,
+		Source:  image.Source,
+		ShaSum:  image.ShaSum,
+	}
+	for _, part := range image.Parts {
+		e.Parts = append(e.Parts, part.Path)
+	}
+	if failure != nil {
+		e.Error = failure.Error()
+	}
+
+	return hooks.Run(cmds, time.Duration(s.cfg.Hooks.Timeout)*time.Second, e)
+}
+
+// notifyHooks runs the hooks for an event that can't be vetoed, logging any
+// that fail.
+func (s Session) notifyHooks(event, display string, image source.Image, failure error) {
+	if err := s.runHooks(event, display, image, failure); err != nil {
+		log.Errorf("Error running hook: %s", err)
+	}
+}
+
+// Blacklist adds an image to the blacklist and runs the on_blacklist hooks.
+// display is the display it was on, if any.
+func (s Session) Blacklist(display string, image source.Image) error {
+	if err := s.WriteList(s.cfg.BlacklistFile, image); err != nil {
+		return err
+	}
+	s.notifyHooks(hooks.Blacklist, display, image, nil)
+
+	return nil
+}
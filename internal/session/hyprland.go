@@ -1,19 +1,26 @@
 package session
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/config"
-	"github.com/joshbeard/walsh/internal/util"
 )
 
 type hyprland struct {
 	cfg *config.Config
 }
 
-var _ SessionProvider = &hyprland{}
+var (
+	_ SessionProvider   = &hyprland{}
+	_ DisplayWatcher    = &hyprland{}
+	_ BatchSetter       = &hyprland{}
+	_ SharedSetter      = &hyprland{}
+	_ FormatProvider    = &hyprland{}
+	_ AnimationProvider = &hyprland{}
+	_ WorkspaceWatcher  = &hyprland{}
+)
 
 func NewHyprland(cfg *config.Config) SessionProvider {
 	return &hyprland{cfg: cfg}
@@ -22,70 +29,94 @@ func NewHyprland(cfg *config.Config) SessionProvider {
 // SetWallpaper sets the wallpaper for the specified display in a Hyprland
 // session.
 func (h hyprland) SetWallpaper(path string, display Display) error {
-	return setWaylandWallpaper(path, display, h.cfg.SetCommand)
+	return setWaylandWallpaper(path, display, h.cfg)
 }
 
-func (h hyprland) getInstance() (string, error) {
-	instances, err := util.RunCmd(`hyprctl -j instances`)
-	if err != nil {
-		return "", fmt.Errorf("failed to run hyprctl -j instances: %w", err)
-	}
-	instancesJSON := []map[string]interface{}{}
-	err = json.Unmarshal([]byte(instances), &instancesJSON)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal hyprctl -j instances: %w", err)
-	}
+// SetWallpapers sets the wallpaper on several displays in a Hyprland
+// session.
+func (h hyprland) SetWallpapers(paths map[string]string) error {
+	return setWaylandWallpapers(paths, h.GetDisplays, h.cfg)
+}
 
-	log.Debugf("found %d hyprland instances", len(instancesJSON))
+// SharesImage returns true if the set tool draws one image on every output
+// in a Hyprland session.
+func (h hyprland) SharesImage() bool {
+	return waylandSharesImage(h.cfg)
+}
+
+// Formats returns the image formats the set tool can display in
+// a Hyprland session.
+func (h hyprland) Formats() []string {
+	return setToolFormats(defaultWaylandSetCmds, h.cfg)
+}
 
-	// Asume instance 0 for now
-	instance := instancesJSON[0]
-	instanceID := instance["instance"].(string)
+// AnimatedFormats returns the formats that can be played in a Hyprland session.
+func (h hyprland) AnimatedFormats() []string {
+	return waylandAnimatedFormats(h.cfg)
+}
 
-	return instanceID, nil
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display in a Hyprland session.
+func (h hyprland) SetAnimatedWallpaper(path string, display Display) error {
+	return setWaylandAnimated(path, display, h.cfg)
 }
 
 // GetDisplays returns a list of displays in a Hyprland session.
-// This uses the `hyprctl monitors` command to get a list of displays.
+// This queries the monitors over the request socket of the instance in
+// HYPRLAND_INSTANCE_SIGNATURE.
 func (h hyprland) GetDisplays() ([]Display, error) {
-	instance, err := h.getInstance()
+	ipc, err := newHyprlandIPC()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get instance: %w", err)
 	}
 
-	monitorCmd := fmt.Sprintf("hyprctl -i %s -j monitors", instance)
-	result, err := util.RunCmd(monitorCmd)
+	monitors, err := ipc.GetMonitors()
 	if err != nil {
-		return nil, fmt.Errorf("failed to run hyprctl monitors: %w", err)
+		return nil, fmt.Errorf("failed to get hyprland monitors: %w", err)
 	}
 
-	return h.parseDisplays(result)
+	displays := hyprlandMonitorsToDisplays(monitors)
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
 }
 
-// GetCurrentWallpaper returns the current wallpaper for the specified display
-// in a Hyprland session. This uses the `swww query` command to get the current
-// wallpaper.
-func (h hyprland) GetCurrentWallpaper(display, _ Display) (string, error) {
-	return getSwwwWallpaper(display, Display{})
+// WatchDisplays sends on changes when Hyprland reports a monitor being added
+// or removed.
+func (h hyprland) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newHyprlandIPC()
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	return ipc.WatchDisplays(ctx, changes)
 }
 
-// parseDisplays parses the output of `hyprctl monitors` and returns a list of
-// displays in their struct form.
-func (h hyprland) parseDisplays(output string) ([]Display, error) {
-	jsonOutput := []map[string]interface{}{}
-	err := json.Unmarshal([]byte(output), &jsonOutput)
+// ActiveWorkspaces returns the workspace shown on each monitor in a Hyprland
+// session.
+func (h hyprland) ActiveWorkspaces() (map[string]string, error) {
+	ipc, err := newHyprlandIPC()
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal hyprctl monitors: %w", err)
+		return nil, fmt.Errorf("failed to get instance: %w", err)
 	}
 
-	displays := []Display{}
-	for i, monitor := range jsonOutput {
-		displays = append(displays, Display{
-			Name:  monitor["name"].(string),
-			Index: i,
-			// Index: int(monitor["id"].(float64)),
-		})
+	return ipc.ActiveWorkspaces()
+}
+
+// WatchWorkspaces sends on changes when Hyprland reports a workspace being
+// shown or moved.
+func (h hyprland) WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newHyprlandIPC()
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", err)
 	}
 
-	return displays, nil
+	return ipc.WatchWorkspaces(ctx, changes)
+}
+
+// GetCurrentWallpaper returns the current wallpaper for the specified display
+// in a Hyprland session. This uses the `swww query` command when swww is
+// available, and otherwise the last wallpaper walsh set on the display.
+func (h hyprland) GetCurrentWallpaper(display, current Display) (string, error) {
+	return getWaylandWallpaper(display, current)
 }
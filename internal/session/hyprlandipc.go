@@ -0,0 +1,265 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// hyprlandIPCTimeout is the deadline for a single request/response exchange.
+const hyprlandIPCTimeout = 5 * time.Second
+
+// hyprlandMonitor is a monitor as reported by `j/monitors all`.
+type hyprlandMonitor struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Make        string  `json:"make"`
+	Model       string  `json:"model"`
+	Serial      string  `json:"serial"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Scale       float64 `json:"scale"`
+	Transform   int     `json:"transform"`
+	Disabled    bool    `json:"disabled"`
+
+	ActiveWorkspace struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"activeWorkspace"`
+}
+
+// hyprlandIPC is a client for Hyprland's request socket.
+type hyprlandIPC struct {
+	dir string
+}
+
+// newHyprlandIPC returns an IPC client for the Hyprland instance identified
+// by HYPRLAND_INSTANCE_SIGNATURE. If the variable is unset and exactly one
+// instance is running, that instance is used.
+func newHyprlandIPC() (*hyprlandIPC, error) {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature != "" {
+		for _, base := range hyprlandRuntimeDirs() {
+			dir := filepath.Join(base, signature)
+			if isSocket(filepath.Join(dir, ".socket.sock")) {
+				return &hyprlandIPC{dir: dir}, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no socket found for Hyprland instance %s", signature)
+	}
+
+	var instances []string
+	for _, base := range hyprlandRuntimeDirs() {
+		matches, err := filepath.Glob(filepath.Join(base, "*", ".socket.sock"))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			instances = append(instances, filepath.Dir(match))
+		}
+	}
+
+	log.Debugf("found %d hyprland instances", len(instances))
+
+	switch len(instances) {
+	case 0:
+		return nil, errors.New("no Hyprland instances found")
+	case 1:
+		return &hyprlandIPC{dir: instances[0]}, nil
+	default:
+		return nil, errors.New(
+			"multiple Hyprland instances found and HYPRLAND_INSTANCE_SIGNATURE is not set",
+		)
+	}
+}
+
+// hyprlandRuntimeDirs returns the directories Hyprland may create its
+// instance directories in. Newer releases use XDG_RUNTIME_DIR, older ones
+// use /tmp.
+func hyprlandRuntimeDirs() []string {
+	dirs := []string{}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		dirs = append(dirs, filepath.Join(runtimeDir, "hypr"))
+	}
+
+	return append(dirs, "/tmp/hypr")
+}
+
+// isSocket returns true if the path exists and is a Unix socket.
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeSocket != 0
+}
+
+// request sends a command to the request socket and returns the reply.
+func (c hyprlandIPC) request(command string) ([]byte, error) {
+	socket := filepath.Join(c.dir, ".socket.sock")
+	conn, err := net.DialTimeout("unix", socket, hyprlandIPCTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(hyprlandIPCTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	if _, err = conn.Write([]byte(command)); err != nil {
+		return nil, fmt.Errorf("failed to write request: %w", err)
+	}
+
+	// Hyprland closes the connection once the reply has been written.
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply: %w", err)
+	}
+
+	return reply, nil
+}
+
+// GetMonitors returns all monitors, including disabled ones.
+func (c hyprlandIPC) GetMonitors() ([]hyprlandMonitor, error) {
+	reply, err := c.request("j/monitors all")
+	if err != nil {
+		return nil, err
+	}
+
+	var monitors []hyprlandMonitor
+	if err = json.Unmarshal(reply, &monitors); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal monitors: %w", err)
+	}
+
+	return monitors, nil
+}
+
+// Events subscribes to the event socket and calls onEvent with the name and
+// data of every event received. It blocks until ctx is cancelled or the
+// connection fails.
+func (c hyprlandIPC) Events(ctx context.Context, onEvent func(event, data string)) error {
+	socket := filepath.Join(c.dir, ".socket2.sock")
+	conn, err := net.DialTimeout("unix", socket, hyprlandIPCTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+
+	// Unblock the scanner when the context is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Events are newline separated and formatted as EVENT>>DATA.
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		event, data, found := strings.Cut(scanner.Text(), ">>")
+		if !found {
+			continue
+		}
+
+		onEvent(event, data)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return errors.New("hyprland event socket closed")
+}
+
+// WatchDisplays sends on changes whenever a monitor is added or removed.
+func (c hyprlandIPC) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	return c.Events(ctx, func(event, _ string) {
+		switch event {
+		case "monitoradded", "monitorremoved":
+			notifyChange(changes)
+		}
+	})
+}
+
+// ActiveWorkspaces returns the name of the workspace shown on each enabled
+// monitor, keyed by monitor name.
+func (c hyprlandIPC) ActiveWorkspaces() (map[string]string, error) {
+	monitors, err := c.GetMonitors()
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]string, len(monitors))
+	for _, monitor := range monitors {
+		if !monitor.Disabled && monitor.ActiveWorkspace.Name != "" {
+			active[monitor.Name] = monitor.ActiveWorkspace.Name
+		}
+	}
+
+	return active, nil
+}
+
+// WatchWorkspaces sends on changes whenever a workspace is shown on a
+// monitor or moved to another one. The original event names are used, since
+// older releases don't send the v2 events.
+func (c hyprlandIPC) WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error {
+	return c.Events(ctx, func(event, _ string) {
+		switch event {
+		case "workspace", "moveworkspace":
+			notifyChange(changes)
+		}
+	})
+}
+
+// hyprlandMonitorsToDisplays converts enabled monitors to displays.
+func hyprlandMonitorsToDisplays(monitors []hyprlandMonitor) []Display {
+	displays := make([]Display, 0, len(monitors))
+	for _, monitor := range monitors {
+		if monitor.Disabled {
+			continue
+		}
+
+		scale := monitor.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+
+		// Width and height are the mode's size before the transform.
+		width, height := monitor.Width, monitor.Height
+		if monitor.Transform%2 == 1 {
+			width, height = height, width
+		}
+
+		displays = append(displays, Display{
+			Index:     len(displays),
+			Name:      monitor.Name,
+			Make:      monitor.Make,
+			Model:     monitor.Model,
+			Serial:    monitor.Serial,
+			X:         monitor.X,
+			Y:         monitor.Y,
+			Width:     width,
+			Height:    height,
+			Scale:     scale,
+			Transform: monitor.Transform,
+		})
+	}
+
+	return displays
+}
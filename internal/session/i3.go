@@ -0,0 +1,165 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+)
+
+// i3 is an i3 session on Xorg. Displays are queried over the i3 IPC socket,
+// while wallpapers are set with the same tools as a plain Xorg session.
+type i3 struct {
+	cfg  *config.Config
+	xorg *xorg
+}
+
+var (
+	_ SessionProvider   = &i3{}
+	_ DisplayWatcher    = &i3{}
+	_ BatchSetter       = &i3{}
+	_ Spanner           = &i3{}
+	_ FormatProvider    = &i3{}
+	_ AnimationProvider = &i3{}
+	_ WorkspaceWatcher  = &i3{}
+)
+
+func NewI3(cfg *config.Config) SessionProvider {
+	return &i3{cfg: cfg, xorg: &xorg{cfg: cfg}}
+}
+
+// SetWallpaper sets the wallpaper for the specified display in an i3
+// session. Xorg wallpaper tools address displays by their head index rather
+// than the output name.
+func (i i3) SetWallpaper(path string, display Display) error {
+	heads, err := xrandrHeads()
+	if err != nil {
+		return err
+	}
+
+	head, err := xorgHead(heads, display.Name)
+	if err != nil {
+		return err
+	}
+	display.Name = head
+
+	return i.xorg.SetWallpaper(path, display)
+}
+
+// SetWallpapers sets the wallpaper on several displays in an i3 session,
+// translating output names to the head indices used by the Xorg tools.
+func (i i3) SetWallpapers(paths map[string]string) error {
+	heads, err := xrandrHeads()
+	if err != nil {
+		return err
+	}
+
+	headPaths := make(map[string]string, len(paths))
+	for name, path := range paths {
+		head, err := xorgHead(heads, name)
+		if err != nil {
+			return err
+		}
+		headPaths[head] = path
+	}
+
+	return i.xorg.SetWallpapers(headPaths)
+}
+
+// xorgHead returns the head index the Xorg tools use for an output. It's
+// looked up by name from xrandr, since the order i3 reports outputs in
+// needn't match the order of the heads.
+func xorgHead(heads map[string]int, output string) (string, error) {
+	index, ok := heads[output]
+	if !ok {
+		return "", fmt.Errorf("output %s is not an active xrandr monitor", output)
+	}
+
+	return strconv.Itoa(index), nil
+}
+
+// SpanWallpaper spans the image across all displays in an i3 session.
+func (i i3) SpanWallpaper(path string) error {
+	return i.xorg.SpanWallpaper(path)
+}
+
+// Formats returns the image formats the Xorg set tool can display.
+func (i i3) Formats() []string {
+	return i.xorg.Formats()
+}
+
+// AnimatedFormats returns the formats the Xorg players can play.
+func (i i3) AnimatedFormats() []string {
+	return i.xorg.AnimatedFormats()
+}
+
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display in an i3 session. The player covers the display's area, so the
+// output name is kept.
+func (i i3) SetAnimatedWallpaper(path string, display Display) error {
+	return i.xorg.SetAnimatedWallpaper(path, display)
+}
+
+// GetDisplays returns a list of displays in an i3 session.
+// This queries the outputs over the IPC socket in I3SOCK.
+func (i i3) GetDisplays() ([]Display, error) {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := ipc.GetOutputs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get i3 outputs: %w", err)
+	}
+
+	// i3 doesn't report EDID information, so take it from xrandr.
+	displays := swayOutputsToDisplays(outputs)
+	if edids, err := xrandrEDIDs(); err == nil {
+		for i, d := range displays {
+			info := edids[d.Name]
+			displays[i].Make, displays[i].Model, displays[i].Serial = info.Make, info.Model, info.Serial
+		}
+	}
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
+}
+
+// WatchDisplays sends on changes when i3 reports an output event.
+func (i i3) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return err
+	}
+
+	return ipc.WatchDisplays(ctx, changes)
+}
+
+// ActiveWorkspaces returns the workspace shown on each output in an i3
+// session.
+func (i i3) ActiveWorkspaces() (map[string]string, error) {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return nil, err
+	}
+
+	return ipc.ActiveWorkspaces()
+}
+
+// WatchWorkspaces sends on changes when i3 reports a workspace event.
+func (i i3) WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return err
+	}
+
+	return ipc.WatchWorkspaces(ctx, changes)
+}
+
+// GetCurrentWallpaper returns the last wallpaper walsh set on the display.
+func (i i3) GetCurrentWallpaper(display, current Display) (string, error) {
+	return i.xorg.GetCurrentWallpaper(display, current)
+}
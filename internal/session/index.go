@@ -0,0 +1,118 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// indexEntry is what's known about an image with a given checksum.
+type indexEntry struct {
+	// DHash is the image's difference hash in hex, used to find resized or
+	// recompressed copies.
+	DHash  string `json:"dhash"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// imageIndex caches the perceptual hash and size of images by checksum, so
+// images are only decoded once.
+type imageIndex struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]indexEntry
+	changed bool
+}
+
+// loadIndex reads the image index. A missing or unreadable index starts
+// empty.
+func loadIndex(path string) *imageIndex {
+	idx := &imageIndex{path: path, entries: map[string]indexEntry{}}
+	if !util.FileExists(path) {
+		return idx
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &idx.entries)
+	}
+	if err != nil {
+		log.Warnf("Error reading image index %s, rebuilding it: %s", path, err)
+		idx.entries = map[string]indexEntry{}
+	}
+
+	return idx
+}
+
+// lookup returns the index entry for an image, decoding the image to hash
+// it if it isn't indexed yet.
+func (idx *imageIndex) lookup(image source.Image) (indexEntry, error) {
+	idx.mu.Lock()
+	entry, ok := idx.entries[image.ShaSum]
+	idx.mu.Unlock()
+	if ok {
+		return entry, nil
+	}
+
+	img, err := imaging.Load(image.Path)
+	if err != nil {
+		return indexEntry{}, err
+	}
+
+	entry = indexEntry{
+		DHash:  strconv.FormatUint(imaging.DHash(img), 16),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+
+	idx.mu.Lock()
+	idx.entries[image.ShaSum] = entry
+	idx.changed = true
+	idx.mu.Unlock()
+
+	return entry, nil
+}
+
+// hash returns the difference hash of an image.
+func (idx *imageIndex) hash(image source.Image) (uint64, error) {
+	entry, err := idx.lookup(image)
+	if err != nil {
+		return 0, err
+	}
+
+	hash, err := strconv.ParseUint(entry.DHash, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash for %s in the index: %w", image.Path, err)
+	}
+
+	return hash, nil
+}
+
+// save writes the index if anything was added to it.
+func (idx *imageIndex) save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(idx.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the image index: %w", err)
+	}
+
+	if err = os.WriteFile(idx.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the image index: %w", err)
+	}
+	idx.changed = false
+
+	return nil
+}
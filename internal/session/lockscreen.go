@@ -0,0 +1,279 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// Markers around the part of a lock screen config that walsh manages. The
+// rest of the file is left alone.
+const (
+	lockBlockStart = "# BEGIN walsh"
+	lockBlockEnd   = "# END walsh"
+)
+
+// defaultLockBlur and defaultLockBrightness are the effects applied to lock
+// screen images unless they're configured.
+var (
+	defaultLockBlur       = 16.0
+	defaultLockBrightness = 0.8
+)
+
+// lockscreenDir returns the directory lock screen images are written to.
+func (s Session) lockscreenDir() string {
+	if s.cfg.Lockscreen.Dir != "" {
+		return os.ExpandEnv(s.cfg.Lockscreen.Dir)
+	}
+
+	return filepath.Join(xdg.DataHome, "walsh", "lockscreen")
+}
+
+// SetLockscreen writes the lock screen images and configs. With sources, or
+// configured lock screen sources, a random image is picked for each display
+// from them. Otherwise each display's current wallpaper is used.
+func (s Session) SetLockscreen(sources []string) error {
+	if len(sources) == 0 {
+		sources = s.cfg.Lockscreen.Sources
+	}
+	if len(sources) == 0 {
+		return s.LockscreenFromWallpapers()
+	}
+
+	images, err := s.getImages(sources)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]string, len(s.displays))
+	for _, d := range s.displays {
+		image, err := s.pickValid(
+			func() (source.Image, error) {
+				if len(images) == 0 {
+					return source.Image{}, errNoImages
+				}
+
+				return source.Random(images, s.cfg.CacheDir)
+			},
+			func(image source.Image) { images = source.RemoveImage(images, image) },
+		)
+		if err != nil {
+			return err
+		}
+
+		if source.IsGenerated(image) {
+			if image, err = source.Generate(image, d.Width, d.Height, s.cfg.CacheDir); err != nil {
+				return err
+			}
+		}
+
+		paths[d.Name] = image.Path
+		if len(images) > len(s.displays) {
+			images = source.RemoveImage(images, image)
+		}
+	}
+
+	return s.writeLockscreen(paths)
+}
+
+// LockscreenFromWallpapers writes the lock screen images and configs from
+// each display's current wallpaper.
+func (s Session) LockscreenFromWallpapers() error {
+	current, err := s.ReadCurrent()
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]string, len(s.displays))
+	for _, d := range s.displays {
+		cur, err := current.ForDisplay(d)
+		if err != nil || !util.FileExists(cur.Current.Path) {
+			continue
+		}
+		paths[d.Name] = cur.Current.Path
+	}
+
+	if len(paths) == 0 {
+		return errors.New("no current wallpapers recorded")
+	}
+
+	return s.writeLockscreen(paths)
+}
+
+// refreshLockscreen updates the lock screen after wallpapers have been set,
+// if it's enabled and follows the wallpaper.
+func (s Session) refreshLockscreen() {
+	if !s.cfg.Lockscreen.Enabled || len(s.cfg.Lockscreen.Sources) > 0 {
+		return
+	}
+
+	if err := s.LockscreenFromWallpapers(); err != nil {
+		log.Errorf("Error updating lock screen: %s", err)
+	}
+}
+
+// writeLockscreen writes a lock screen image for each display from the
+// images in paths, keyed by display name, then points the lock screen
+// configs at them and copies the first to the greeter path.
+func (s Session) writeLockscreen(paths map[string]string) error {
+	dir := s.lockscreenDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	lockImages := make(map[string]string, len(paths))
+	var displays []Display
+	for _, d := range s.displays {
+		path, ok := paths[d.Name]
+		if !ok {
+			continue
+		}
+
+		processed, err := s.lockImage(path, d)
+		if err != nil {
+			return fmt.Errorf("display %s: %w", d.Name, err)
+		}
+
+		// Lock images keep the processed image's format, so remove one left
+		// in the other format.
+		base := filepath.Join(dir, pidFileNameRe.ReplaceAllString(d.Name, "_"))
+		dest := base + filepath.Ext(processed)
+		for _, ext := range []string{".jpg", ".png"} {
+			if base+ext != dest {
+				_ = os.Remove(base + ext)
+			}
+		}
+
+		if err = copyWorldReadable(processed, dest); err != nil {
+			return fmt.Errorf("display %s: %w", d.Name, err)
+		}
+		log.Debugf("Wrote lock screen image for display %s: %s", d.Name, dest)
+
+		lockImages[d.Name] = dest
+		displays = append(displays, d)
+	}
+
+	cfg := s.cfg.Lockscreen
+	if cfg.Swaylock != "" {
+		var lines []string
+		for _, d := range displays {
+			lines = append(lines, fmt.Sprintf("image=%s:%s", d.Name, lockImages[d.Name]))
+		}
+		if err := writeManagedBlock(os.ExpandEnv(cfg.Swaylock), lines); err != nil {
+			return fmt.Errorf("failed to update swaylock config: %w", err)
+		}
+	}
+
+	if cfg.Hyprlock != "" {
+		var lines []string
+		for _, d := range displays {
+			lines = append(lines,
+				"background {",
+				"    monitor = "+d.Name,
+				"    path = "+lockImages[d.Name],
+				"}")
+		}
+		if err := writeManagedBlock(os.ExpandEnv(cfg.Hyprlock), lines); err != nil {
+			return fmt.Errorf("failed to update hyprlock config: %w", err)
+		}
+	}
+
+	if cfg.Greeter != "" && len(displays) > 0 {
+		if err := copyWorldReadable(lockImages[displays[0].Name], os.ExpandEnv(cfg.Greeter)); err != nil {
+			return fmt.Errorf("failed to copy greeter background: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// lockImage fits the image at path to the display, applies the lock screen
+// effects and returns the path of the result in the cache directory. Like
+// processed wallpapers, it's named by the image's hash and the options, so
+// displays whose wallpaper hasn't changed aren't processed again.
+func (s Session) lockImage(path string, d Display) (string, error) {
+	path, err := s.decodableImage(path, d.Width, d.Height)
+	if err != nil {
+		return "", err
+	}
+
+	effectsCfg := s.cfg.Lockscreen.Effects
+	if effectsCfg.Blur == nil {
+		effectsCfg.Blur = &defaultLockBlur
+	}
+	if effectsCfg.Brightness == nil {
+		effectsCfg.Brightness = &defaultLockBrightness
+	}
+
+	effects, err := toEffects(effectsCfg)
+	if err != nil {
+		return "", err
+	}
+
+	opts := imaging.Options{Effects: effects}
+	if d.Width > 0 && d.Height > 0 {
+		opts.Width, opts.Height, opts.Mode = d.Width, d.Height, imaging.ModeFill
+		opts.Focus = imaging.FocusCenter
+	}
+
+	return s.processImage(path, opts)
+}
+
+// writeManagedBlock replaces the lines between the walsh markers in a
+// config file, or appends them if the file doesn't have the markers yet.
+func writeManagedBlock(path string, lines []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	block := lockBlockStart + "\n" + strings.Join(lines, "\n") + "\n" + lockBlockEnd + "\n"
+
+	content := string(data)
+	start := strings.Index(content, lockBlockStart)
+	end := strings.Index(content, lockBlockEnd)
+	if start >= 0 && end > start {
+		rest := content[end+len(lockBlockEnd):]
+		content = content[:start] + block + strings.TrimPrefix(rest, "\n")
+	} else {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += block
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// copyWorldReadable copies a file to dest and makes it readable by everyone,
+// so a greeter running as another user can show it.
+func copyWorldReadable(src, dest string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(dest, data, 0o644); err != nil {
+		return err
+	}
+
+	// WriteFile doesn't change the mode of an existing file, and the umask
+	// may have narrowed it.
+	return os.Chmod(dest, 0o644)
+}
@@ -5,6 +5,7 @@ package session
 import (
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -16,7 +17,10 @@ type macos struct {
 	cfg *config.Config
 }
 
-var _ SessionProvider = &macos{}
+var (
+	_ SessionProvider = &macos{}
+	_ FormatProvider  = &macos{}
+)
 
 func NewMacOS(cfg *config.Config) SessionProvider {
 	return &macos{cfg: cfg}
@@ -24,7 +28,7 @@ func NewMacOS(cfg *config.Config) SessionProvider {
 
 // isMacOS checks if the current session is macOS.
 func isMacOS() bool {
-	return util.FileExists("/System/Library/CoreServices/SystemVersion.plist")
+	return runtime.GOOS == "darwin"
 }
 
 func (m macos) SetWallpaper(path string, display Display) error {
@@ -45,6 +49,11 @@ func (m macos) SetWallpaper(path string, display Display) error {
 	return nil
 }
 
+// Formats returns the image formats macOS can set as a wallpaper.
+func (m macos) Formats() []string {
+	return []string{"jpeg", "png", "gif", "bmp", "tiff", "webp", "heic"}
+}
+
 func (m macos) GetDisplays() ([]Display, error) {
 	cmd := "system_profiler SPDisplaysDataType -json"
 	results, err := util.RunCmd(cmd)
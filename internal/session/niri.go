@@ -0,0 +1,241 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+)
+
+// niriIPCTimeout is the deadline for a single request/response exchange.
+const niriIPCTimeout = 5 * time.Second
+
+// niriTransforms maps niri's transform names to wl_output transform values.
+var niriTransforms = map[string]int{
+	"Normal":     0,
+	"_90":        1,
+	"_180":       2,
+	"_270":       3,
+	"Flipped":    4,
+	"Flipped90":  5,
+	"Flipped180": 6,
+	"Flipped270": 7,
+}
+
+// niri is a niri session. Outputs are queried over the IPC socket in
+// NIRI_SOCKET and wallpapers are set with swww or swaybg.
+type niri struct {
+	cfg *config.Config
+}
+
+var (
+	_ SessionProvider   = &niri{}
+	_ BatchSetter       = &niri{}
+	_ SharedSetter      = &niri{}
+	_ FormatProvider    = &niri{}
+	_ AnimationProvider = &niri{}
+)
+
+func NewNiri(cfg *config.Config) SessionProvider {
+	return &niri{cfg: cfg}
+}
+
+// niriOutput is an output as reported by the Outputs request. Logical is
+// nil when the output is disabled.
+type niriOutput struct {
+	Name   string  `json:"name"`
+	Make   string  `json:"make"`
+	Model  string  `json:"model"`
+	Serial *string `json:"serial"`
+	Modes  []struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"modes"`
+	CurrentMode *int `json:"current_mode"`
+	Logical     *struct {
+		X         int     `json:"x"`
+		Y         int     `json:"y"`
+		Width     int     `json:"width"`
+		Height    int     `json:"height"`
+		Scale     float64 `json:"scale"`
+		Transform string  `json:"transform"`
+	} `json:"logical"`
+}
+
+// SetWallpaper sets the wallpaper for the specified display in a niri
+// session.
+func (n niri) SetWallpaper(path string, display Display) error {
+	return setWaylandWallpaper(path, display, n.cfg)
+}
+
+// SetWallpapers sets the wallpaper on several displays in a niri
+// session.
+func (n niri) SetWallpapers(paths map[string]string) error {
+	return setWaylandWallpapers(paths, n.GetDisplays, n.cfg)
+}
+
+// SharesImage returns true if the set tool draws one image on every output
+// in a niri session.
+func (n niri) SharesImage() bool {
+	return waylandSharesImage(n.cfg)
+}
+
+// Formats returns the image formats the set tool can display in
+// a niri session.
+func (n niri) Formats() []string {
+	return setToolFormats(defaultWaylandSetCmds, n.cfg)
+}
+
+// AnimatedFormats returns the formats that can be played in a niri session.
+func (n niri) AnimatedFormats() []string {
+	return waylandAnimatedFormats(n.cfg)
+}
+
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display in a niri session.
+func (n niri) SetAnimatedWallpaper(path string, display Display) error {
+	return setWaylandAnimated(path, display, n.cfg)
+}
+
+// GetDisplays returns the enabled outputs in a niri session, ordered by
+// their position in the layout.
+func (n niri) GetDisplays() ([]Display, error) {
+	reply, err := niriRequest(`"Outputs"`)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Ok *struct {
+			Outputs map[string]niriOutput `json:"Outputs"`
+		} `json:"Ok"`
+		Err *string `json:"Err"`
+	}
+	if err = json.Unmarshal(reply, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal niri outputs: %w", err)
+	}
+
+	if response.Err != nil {
+		return nil, fmt.Errorf("niri returned an error: %s", *response.Err)
+	}
+
+	if response.Ok == nil {
+		return nil, errors.New("unexpected reply from niri")
+	}
+
+	displays := niriOutputsToDisplays(response.Ok.Outputs)
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
+}
+
+// GetCurrentWallpaper returns the current wallpaper for the specified display
+// in a niri session.
+func (n niri) GetCurrentWallpaper(display, current Display) (string, error) {
+	return getWaylandWallpaper(display, current)
+}
+
+// niriRequest sends a request to the niri socket and returns the reply.
+// Requests and replies are single lines of JSON.
+func niriRequest(request string) ([]byte, error) {
+	socket := os.Getenv("NIRI_SOCKET")
+	if socket == "" {
+		return nil, errors.New("NIRI_SOCKET is not set")
+	}
+
+	conn, err := net.DialTimeout("unix", socket, niriIPCTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(niriIPCTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	if _, err = conn.Write([]byte(request + "\n")); err != nil {
+		return nil, fmt.Errorf("failed to write request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	reply, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply: %w", err)
+	}
+
+	return reply, nil
+}
+
+// niriOutputsToDisplays converts enabled outputs to displays. niri reports
+// outputs as a map, so they're sorted by position for a stable order.
+func niriOutputsToDisplays(outputs map[string]niriOutput) []Display {
+	enabled := make([]niriOutput, 0, len(outputs))
+	for _, output := range outputs {
+		if output.Logical != nil {
+			enabled = append(enabled, output)
+		}
+	}
+
+	sort.Slice(enabled, func(i, j int) bool {
+		a, b := enabled[i].Logical, enabled[j].Logical
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+
+		return enabled[i].Name < enabled[j].Name
+	})
+
+	displays := make([]Display, 0, len(enabled))
+	for _, output := range enabled {
+		logical := output.Logical
+		transform := niriTransforms[logical.Transform]
+
+		scale := logical.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+
+		// The logical size is already transformed, so use it to derive the
+		// physical size when the current mode isn't known.
+		width := int(float64(logical.Width) * scale)
+		height := int(float64(logical.Height) * scale)
+		if output.CurrentMode != nil && *output.CurrentMode < len(output.Modes) {
+			mode := output.Modes[*output.CurrentMode]
+			width, height = mode.Width, mode.Height
+			if transform%2 == 1 {
+				width, height = height, width
+			}
+		}
+
+		serial := ""
+		if output.Serial != nil {
+			serial = *output.Serial
+		}
+
+		displays = append(displays, Display{
+			Index:     len(displays),
+			Name:      output.Name,
+			Make:      unknownToEmpty(output.Make),
+			Model:     unknownToEmpty(output.Model),
+			Serial:    unknownToEmpty(serial),
+			X:         logical.X,
+			Y:         logical.Y,
+			Width:     width,
+			Height:    height,
+			Scale:     scale,
+			Transform: transform,
+		})
+	}
+
+	return displays
+}
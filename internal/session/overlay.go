@@ -0,0 +1,111 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/imaging"
+)
+
+// overlayData is the data available to overlay text templates.
+type overlayData struct {
+	// Filename is the image's file name and Path its full path.
+	Filename string
+	Path     string
+	// Attribution is the first line of a sidecar text file next to the
+	// image, named after it with a .txt extension.
+	Attribution string
+	Hostname    string
+	Date        string
+	Time        string
+	// Display is the display's name and Description its make, model and
+	// serial, if known.
+	Display     string
+	Description string
+}
+
+// newOverlayData returns the template data for an image on a display.
+func newOverlayData(path string, d Display, now time.Time) overlayData {
+	hostname, _ := os.Hostname()
+
+	return overlayData{
+		Filename:    filepath.Base(path),
+		Path:        path,
+		Attribution: readAttribution(path),
+		Hostname:    hostname,
+		Date:        now.Format("2006-01-02"),
+		Time:        now.Format("15:04"),
+		Display:     d.Name,
+		Description: d.Description(),
+	}
+}
+
+// readAttribution returns the first line of the image's sidecar file, e.g.
+// photo.txt for photo.jpg, or an empty string if there isn't one.
+func readAttribution(path string) string {
+	f, err := os.Open(strings.TrimSuffix(path, filepath.Ext(path)) + ".txt")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text())
+	}
+
+	return ""
+}
+
+// toOverlay renders the overlay config's text for an image on a display.
+func toOverlay(cfg config.OverlayConfig, path string, d Display) (imaging.Overlay, error) {
+	if cfg.Text == "" {
+		return imaging.Overlay{}, nil
+	}
+
+	tmpl, err := template.New("overlay").Parse(cfg.Text)
+	if err != nil {
+		return imaging.Overlay{}, fmt.Errorf("invalid overlay text: %w", err)
+	}
+
+	var text strings.Builder
+	if err = tmpl.Execute(&text, newOverlayData(path, d, time.Now())); err != nil {
+		return imaging.Overlay{}, fmt.Errorf("failed to render overlay text: %w", err)
+	}
+
+	textColor := cfg.Color
+	if textColor == "" {
+		textColor = "#ffffff"
+	}
+	fg, err := imaging.ParseColor(textColor)
+	if err != nil {
+		return imaging.Overlay{}, err
+	}
+
+	overlay := imaging.Overlay{
+		Text:     text.String(),
+		Position: cfg.Position,
+		Font:     cfg.Font,
+		Size:     cfg.Size,
+		Margin:   cfg.Margin,
+		Color:    fg,
+	}
+
+	if overlay.Margin == 0 {
+		overlay.Margin = 24
+	}
+
+	if cfg.Shadow != "" {
+		if overlay.Shadow, err = imaging.ParseColor(cfg.Shadow); err != nil {
+			return imaging.Overlay{}, err
+		}
+	}
+
+	return overlay, nil
+}
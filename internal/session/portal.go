@@ -0,0 +1,227 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/godbus/dbus/v5"
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+const (
+	portalBusName   = "org.freedesktop.portal.Desktop"
+	portalPath      = "/org/freedesktop/portal/desktop"
+	portalWallpaper = "org.freedesktop.portal.Wallpaper"
+	portalRequest   = "org.freedesktop.portal.Request"
+
+	// portalTimeout is how long to wait for the portal to respond. With
+	// show_preview the user has to confirm the wallpaper, so allow longer.
+	portalTimeout        = 30 * time.Second
+	portalPreviewTimeout = 5 * time.Minute
+)
+
+// portalDisplay is the single display reported by the portal session. The
+// portal has no notion of outputs and sets the wallpaper on all of them.
+const portalDisplay = "default"
+
+// portal sets wallpapers through the XDG desktop portal's Wallpaper
+// interface on the session bus. This works for sandboxed applications and
+// desktops that walsh has no specific support for.
+type portal struct {
+	cfg *config.Config
+
+	// connect returns a connection to the bus the portal is on.
+	connect func(...dbus.ConnOption) (*dbus.Conn, error)
+}
+
+var (
+	_ SessionProvider = &portal{}
+	_ Spanner         = &portal{}
+	_ FormatProvider  = &portal{}
+)
+
+func NewPortal(cfg *config.Config) SessionProvider {
+	return &portal{cfg: cfg, connect: dbus.ConnectSessionBus}
+}
+
+// hasSessionBus returns true if a D-Bus session bus is available.
+func hasSessionBus() bool {
+	return os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+}
+
+// SetWallpaper sets the wallpaper with SetWallpaperURI and waits for the
+// portal's response.
+func (p portal) SetWallpaper(path string, _ Display) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	uri := (&url.URL{Scheme: "file", Path: absPath}).String()
+
+	setOn := p.cfg.Portal.SetOn
+	if setOn == "" {
+		setOn = "background"
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to the response before making the call, using the request
+	// path the portal derives from our unique name and handle token.
+	token := "walsh" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	sender := strings.ReplaceAll(strings.TrimPrefix(conn.Names()[0], ":"), ".", "_")
+	handle := dbus.ObjectPath(portalPath + "/request/" + sender + "/" + token)
+
+	if err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(handle),
+		dbus.WithMatchInterface(portalRequest),
+		dbus.WithMatchMember("Response"),
+	); err != nil {
+		return fmt.Errorf("failed to subscribe to the portal response: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+
+	options := map[string]dbus.Variant{
+		"handle_token": dbus.MakeVariant(token),
+		"show-preview": dbus.MakeVariant(p.cfg.Portal.ShowPreview),
+		"set-on":       dbus.MakeVariant(setOn),
+	}
+
+	log.Debugf("Calling %s.SetWallpaperURI with %s (set-on: %s, show-preview: %t)",
+		portalWallpaper, uri, setOn, p.cfg.Portal.ShowPreview)
+
+	var reqHandle dbus.ObjectPath
+	err = conn.Object(portalBusName, portalPath).
+		Call(portalWallpaper+".SetWallpaperURI", 0, "", uri, options).
+		Store(&reqHandle)
+	if err != nil {
+		return fmt.Errorf("failed to call SetWallpaperURI: %w", err)
+	}
+
+	// Older portals don't support handle_token and return another path.
+	if reqHandle != handle {
+		handle = reqHandle
+		if err = conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(handle),
+			dbus.WithMatchInterface(portalRequest),
+			dbus.WithMatchMember("Response"),
+		); err != nil {
+			return fmt.Errorf("failed to subscribe to the portal response: %w", err)
+		}
+	}
+
+	timeout := portalTimeout
+	if p.cfg.Portal.ShowPreview {
+		timeout = portalPreviewTimeout
+	}
+
+	return waitPortalResponse(signals, handle, timeout)
+}
+
+// waitPortalResponse waits for the Response signal for a request and
+// returns an error unless it reports success.
+func waitPortalResponse(signals <-chan *dbus.Signal, handle dbus.ObjectPath, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("connection to the session bus was closed")
+			}
+
+			if sig.Path != handle || sig.Name != portalRequest+".Response" || len(sig.Body) == 0 {
+				continue
+			}
+
+			code, _ := sig.Body[0].(uint32)
+			switch code {
+			case 0:
+				return nil
+			case 1:
+				return errors.New("setting the wallpaper was cancelled")
+			default:
+				return fmt.Errorf("the portal failed to set the wallpaper (response %d)", code)
+			}
+		case <-deadline:
+			return errors.New("timed out waiting for the portal to respond")
+		}
+	}
+}
+
+// SpanWallpaper spans the image across every monitor on GNOME, which
+// supports it with the "spanned" picture option. The portal itself has no
+// way to span, so other desktops aren't supported.
+func (p portal) SpanWallpaper(path string) error {
+	if !isGNOME() {
+		return ErrSpanUnsupported
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	uri := (&url.URL{Scheme: "file", Path: absPath}).String()
+
+	for _, cmd := range []string{
+		"gsettings set org.gnome.desktop.background picture-options 'spanned'",
+		"gsettings set org.gnome.desktop.background picture-uri '" + uri + "'",
+		"gsettings set org.gnome.desktop.background picture-uri-dark '" + uri + "'",
+	} {
+		if _, err = util.RunCmd(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isGNOME returns true in a GNOME session with gsettings available.
+func isGNOME() bool {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return false
+	}
+
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if strings.EqualFold(desktop, "GNOME") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats returns the image formats desktops commonly accept through the
+// portal.
+func (p portal) Formats() []string {
+	return []string{"jpeg", "png", "gif", "bmp", "tiff", "webp"}
+}
+
+// GetDisplays returns a single display, as the portal sets the wallpaper on
+// every output at once.
+func (p portal) GetDisplays() ([]Display, error) {
+	return []Display{{Index: 0, Name: portalDisplay}}, nil
+}
+
+// GetCurrentWallpaper returns the last wallpaper walsh set, as the portal has
+// no way to query it.
+func (p portal) GetCurrentWallpaper(_, current Display) (string, error) {
+	if current.Current.Path == "" {
+		return "", errors.New("no wallpaper found")
+	}
+
+	return current.Current.Path, nil
+}
@@ -0,0 +1,205 @@
+package session
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/joshbeard/walsh/internal/config"
+)
+
+// privateBusConfig is a minimal dbus-daemon config for a private bus that
+// lets anyone own names and send messages.
+const privateBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%DIR%</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startPrivateBus starts a dbus-daemon for the test and returns its address.
+// The test is skipped if dbus-daemon isn't installed.
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "bus.conf")
+	if err = os.WriteFile(configFile, []byte(strings.ReplaceAll(privateBusConfig, "%DIR%", dir)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configFile, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the bus address: %v", err)
+	}
+
+	return strings.TrimSpace(address)
+}
+
+// fakePortal implements SetWallpaperURI on the Wallpaper interface and
+// answers each request with a Response signal.
+type fakePortal struct {
+	conn *dbus.Conn
+
+	// response is the code sent in the Response signal.
+	response uint32
+	// ignoreToken makes the portal pick its own request path, like portals
+	// that predate handle_token.
+	ignoreToken bool
+
+	mu      sync.Mutex
+	uri     string
+	options map[string]dbus.Variant
+}
+
+func (f *fakePortal) SetWallpaperURI(
+	sender dbus.Sender, _, uri string, options map[string]dbus.Variant,
+) (dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	f.uri, f.options = uri, options
+	f.mu.Unlock()
+
+	token, _ := options["handle_token"].Value().(string)
+	if f.ignoreToken {
+		token = "legacy"
+	}
+	name := strings.ReplaceAll(strings.TrimPrefix(string(sender), ":"), ".", "_")
+	handle := dbus.ObjectPath(portalPath + "/request/" + name + "/" + token)
+
+	// Respond once the reply has been sent, as the portal does.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = f.conn.Emit(handle, portalRequest+".Response", f.response, map[string]dbus.Variant{})
+	}()
+
+	return handle, nil
+}
+
+func TestPortalSetWallpaper(t *testing.T) {
+	address := startPrivateBus(t)
+
+	tests := []struct {
+		name        string
+		cfg         config.PortalConfig
+		response    uint32
+		ignoreToken bool
+		wantSetOn   string
+		wantPreview bool
+		wantErr     string
+	}{
+		{
+			name:      "defaults",
+			wantSetOn: "background",
+		},
+		{
+			name:        "configured options",
+			cfg:         config.PortalConfig{SetOn: "both", ShowPreview: true},
+			wantSetOn:   "both",
+			wantPreview: true,
+		},
+		{
+			name:        "request path chosen by the portal",
+			ignoreToken: true,
+			wantSetOn:   "background",
+		},
+		{
+			name:      "cancelled",
+			response:  1,
+			wantSetOn: "background",
+			wantErr:   "cancelled",
+		},
+		{
+			name:      "failed",
+			response:  2,
+			wantSetOn: "background",
+			wantErr:   "response 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := dbus.Connect(address)
+			if err != nil {
+				t.Fatalf("failed to connect the fake portal: %v", err)
+			}
+			defer server.Close()
+
+			fake := &fakePortal{conn: server, response: tt.response, ignoreToken: tt.ignoreToken}
+			if err = server.ExportMethodTable(map[string]any{
+				"SetWallpaperURI": fake.SetWallpaperURI,
+			}, portalPath, portalWallpaper); err != nil {
+				t.Fatal(err)
+			}
+
+			reply, err := server.RequestName(portalBusName, dbus.NameFlagDoNotQueue)
+			if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+				t.Fatalf("failed to own %s: %v (reply %d)", portalBusName, err, reply)
+			}
+			defer func() { _, _ = server.ReleaseName(portalBusName) }()
+
+			p := portal{
+				cfg: &config.Config{Portal: tt.cfg},
+				connect: func(opts ...dbus.ConnOption) (*dbus.Conn, error) {
+					return dbus.Connect(address, opts...)
+				},
+			}
+
+			err = p.SetWallpaper("wallpaper.jpg", Display{Name: portalDisplay})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("SetWallpaper: %v", err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+
+			wantPath, _ := filepath.Abs("wallpaper.jpg")
+			if fake.uri != "file://"+wantPath {
+				t.Errorf("uri = %q, want %q", fake.uri, "file://"+wantPath)
+			}
+			if got, _ := fake.options["set-on"].Value().(string); got != tt.wantSetOn {
+				t.Errorf("set-on = %q, want %q", got, tt.wantSetOn)
+			}
+			if got, _ := fake.options["show-preview"].Value().(bool); got != tt.wantPreview {
+				t.Errorf("show-preview = %t, want %t", got, tt.wantPreview)
+			}
+			if got, _ := fake.options["handle_token"].Value().(string); !strings.HasPrefix(got, "walsh") {
+				t.Errorf("handle_token = %q, want a walsh token", got)
+			}
+		})
+	}
+}
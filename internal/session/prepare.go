@@ -0,0 +1,176 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// imageOptions returns the options for processing the image at path for a
+// display, from the global config overridden by the display's config.
+// Effects and overlay from the active schedule phase override both. Images
+// with an overlay are fitted with "fill" if no fit mode is set, so the tool
+// doesn't crop the text off.
+func (s Session) imageOptions(path string, d Display) (imaging.Options, error) {
+	displayCfg := s.DisplayConfig(d)
+	fit := s.cfg.Fit.Merge(displayCfg.Fit)
+
+	effectsCfg := s.cfg.Effects.Merge(displayCfg.Effects)
+	overlayCfg := s.cfg.Overlay.Merge(displayCfg.Overlay)
+	if phase, ok := s.cfg.ActivePhase(time.Now()); ok {
+		log.Debugf("Using effects and overlay from schedule phase %s", phase.Name)
+		effectsCfg = effectsCfg.Merge(phase.Effects)
+		overlayCfg = overlayCfg.Merge(phase.Overlay)
+	}
+
+	effects, err := toEffects(effectsCfg)
+	if err != nil {
+		return imaging.Options{}, err
+	}
+
+	overlay, err := toOverlay(overlayCfg, path, d)
+	if err != nil {
+		return imaging.Options{}, err
+	}
+
+	mode, err := imaging.ParseMode(fit.Mode)
+	if err != nil {
+		return imaging.Options{}, err
+	}
+	if mode == "" && overlay.Text != "" {
+		mode = imaging.ModeFill
+	}
+
+	background, err := imaging.ParseColor(fit.Background)
+	if err != nil {
+		return imaging.Options{}, err
+	}
+
+	focus, err := imaging.ParseFocus(fit.Focus)
+	if err != nil {
+		return imaging.Options{}, err
+	}
+
+	return imaging.Options{
+		Width:      d.Width,
+		Height:     d.Height,
+		Mode:       mode,
+		Background: background,
+		Focus:      focus,
+		Effects:    effects,
+		Overlay:    overlay,
+	}, nil
+}
+
+// toEffects converts the effects config to image effects.
+func toEffects(cfg config.EffectsConfig) (imaging.Effects, error) {
+	effects := imaging.NoEffects
+
+	if cfg.Blur != nil {
+		effects.Blur = *cfg.Blur
+	}
+	if cfg.Brightness != nil {
+		effects.Brightness = *cfg.Brightness
+	}
+	if cfg.Saturation != nil {
+		effects.Saturation = *cfg.Saturation
+	}
+	if cfg.Vignette != nil {
+		effects.Vignette = *cfg.Vignette
+	}
+	if cfg.TintStrength != nil && cfg.Tint != "" {
+		tint, err := imaging.ParseColor(cfg.Tint)
+		if err != nil {
+			return imaging.Effects{}, err
+		}
+		effects.Tint = tint
+		effects.TintStrength = *cfg.TintStrength
+	}
+
+	return effects, nil
+}
+
+// prepareWallpaper returns the image to set on a display. Images in formats
+// the set tool can't display are converted first. If processing is
+// configured, the image is fitted to the display, effects are applied, text is
+// drawn over it and the result is written to the cache directory. It's named
+// by the image's hash and the options, so repeats are reused. The original
+// image is used if it can't be processed.
+func (s Session) prepareWallpaper(path string, d Display) string {
+	opts, err := s.imageOptions(path, d)
+	if err != nil {
+		log.Warnf("Not processing wallpaper for display %s: %s", d.Name, err)
+		return path
+	}
+
+	if opts.Mode != "" && (d.Width <= 0 || d.Height <= 0) {
+		log.Debugf("Not fitting wallpaper for display %s: its size is unknown", d.Name)
+	}
+
+	converted, err := s.convertWallpaper(path, d.Width, d.Height)
+	if err != nil {
+		log.Warnf("Error converting wallpaper for display %s, using the original: %s", d.Name, err)
+		return path
+	}
+
+	return s.processWallpaper(converted, d, opts)
+}
+
+// processWallpaper processes the image at path with opts, falling back to
+// the original if that fails.
+func (s Session) processWallpaper(path string, d Display, opts imaging.Options) string {
+	if !opts.Enabled() {
+		return path
+	}
+
+	prepared, err := s.processImage(path, opts)
+	if err != nil {
+		log.Warnf("Error processing wallpaper for display %s, using the original: %s", d.Name, err)
+		return path
+	}
+
+	return prepared
+}
+
+// processImage writes the image at path processed with opts to the cache
+// directory and returns its path.
+func (s Session) processImage(path string, opts imaging.Options) (string, error) {
+	hash, err := util.Sha256(path)
+	if err != nil {
+		return "", err
+	}
+
+	ext := ".jpg"
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		ext = ".png"
+	}
+
+	dest := filepath.Join(s.cfg.CacheDir, fmt.Sprintf("walsh-%s-%s%s", hash[:16], opts.Key(), ext))
+	if util.FileExists(dest) {
+		log.Debugf("Using cached image %s", dest)
+		return dest, nil
+	}
+
+	img, err := imaging.Load(path)
+	if err != nil {
+		return "", err
+	}
+
+	img, err = imaging.Process(img, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err = imaging.Save(img, dest); err != nil {
+		return "", err
+	}
+	log.Debugf("Wrote processed image %s", dest)
+
+	return dest, nil
+}
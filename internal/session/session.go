@@ -9,8 +9,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/config"
@@ -39,6 +37,7 @@ type Session struct {
 	indexByName    map[string]int     // O(1) lookup of user-facing index by name
 	svc            SessionProvider
 	sessType       SessionType
+	detected       SessionType // the detected session type, which may be overridden
 	cfg            *config.Config
 }
 
@@ -61,10 +60,27 @@ type CurrentWallpaper struct {
 // The name and index are used to identify the display, and are determined by
 // the display's actual identifier (e.g. eDP-1, HDMI-1, etc.) or an index based
 // on how they are queried from the system (e.g. 0, 1, 2, etc.).
+//
+// Make, model and serial identify the monitor itself, which is stable across
+// docks and connector changes. See Display.ID.
+//
+// The geometry fields are populated when the session provider can query them.
+// X and Y are the display's position in the compositor's layout, while Width
+// and Height are its resolution in physical pixels after the transform (a
+// wl_output transform value) is applied.
 type Display struct {
-	Index   int          `json:"index"`
-	Name    string       `json:"name"`
-	Current source.Image `json:"current"`
+	Index     int          `json:"index"`
+	Name      string       `json:"name"`
+	Make      string       `json:"make,omitempty"`
+	Model     string       `json:"model,omitempty"`
+	Serial    string       `json:"serial,omitempty"`
+	X         int          `json:"x,omitempty"`
+	Y         int          `json:"y,omitempty"`
+	Width     int          `json:"width,omitempty"`
+	Height    int          `json:"height,omitempty"`
+	Scale     float64      `json:"scale,omitempty"`
+	Transform int          `json:"transform,omitempty"`
+	Current   source.Image `json:"current"`
 }
 
 // I expect this would need to change to support more varieties of Wayland
@@ -83,8 +99,45 @@ const (
 	SessionTypeSway
 	SessionTypeHyprland
 	SessionTypeMacOS
+	SessionTypeI3
+	SessionTypeNiri
+	SessionTypePortal
+	SessionTypeCustom
 )
 
+// sessionTypeNames are the names used to select a session type in the
+// config.
+var sessionTypeNames = map[SessionType]string{
+	SessionTypeX11Unknown: "xorg",
+	SessionTypeWayland:    "wayland",
+	SessionTypeSway:       "sway",
+	SessionTypeHyprland:   "hyprland",
+	SessionTypeMacOS:      "macos",
+	SessionTypeI3:         "i3",
+	SessionTypeNiri:       "niri",
+	SessionTypePortal:     "portal",
+	SessionTypeCustom:     "custom",
+}
+
+func (st SessionType) String() string {
+	if name, ok := sessionTypeNames[st]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// ParseSessionType returns the session type with the given name.
+func ParseSessionType(name string) (SessionType, error) {
+	for st, n := range sessionTypeNames {
+		if strings.EqualFold(n, name) {
+			return st, nil
+		}
+	}
+
+	return SessionTypeUnknown, fmt.Errorf("unknown session type: %s", name)
+}
+
 // SetWallpaperParams is a struct for setting the wallpaper.
 type SetWallpaperParams struct {
 	Path    string
@@ -92,53 +145,126 @@ type SetWallpaperParams struct {
 	Display string
 }
 
-// NewSession creates a new session based on the current session type.
+// NewSession creates a new session based on the current session type, or
+// the session type set in the config.
 func NewSession(cfg *config.Config) (*Session, error) {
-	sessType, err := detect()
+	detected, err := detectSession(cfg)
+
+	sessType := detected
+	name, _ := cfg.SessionOverride()
+	forced := name != ""
+	if forced {
+		sessType, err = ParseSessionType(name)
+		log.Debugf("Using configured %s session (detected %s)", sessType, detected)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var svc SessionProvider
-	switch sessType {
-	case SessionTypeHyprland:
-		svc = NewHyprland(cfg)
-	case SessionTypeX11Unknown:
-		svc = NewXorg(cfg)
-	case SessionTypeMacOS:
-		svc = NewMacOS(cfg)
-	case SessionTypeSway:
-		svc = NewSway(cfg)
-	default:
-		log.Warnf("Unknown session type: %d", sessType)
-		return nil, errors.New("unknown session type")
+	svc, err := newProvider(sessType, cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	displays, err := svc.GetDisplays()
+	if err != nil && !forced && sessType != SessionTypePortal && hasSessionBus() {
+		// The desktop may not provide the tools the detected session needs,
+		// e.g. wlr-randr on GNOME or KDE, so fall back to the portal.
+		log.Warnf("Error getting displays for %s session, falling back to the desktop portal: %s",
+			sessType, err)
+		sessType = SessionTypePortal
+		svc = NewPortal(cfg)
+		displays, err = svc.GetDisplays()
+	}
 	if err != nil {
 		log.Errorf("Error getting displays: %s", err)
 		return nil, err
 	}
 
 	session := &Session{
-		svc:            svc,
-		sessType:       sessType,
-		displays:       displays,
-		cfg:            cfg,
-		displayByName:  make(map[string]Display),
-		displayByIndex: make(map[int]Display),
-		indexByName:    make(map[string]int),
+		svc:      svc,
+		sessType: sessType,
+		detected: detected,
+		cfg:      cfg,
 	}
+	session.setDisplays(displays)
+
+	return session, nil
+}
+
+// newProvider returns the session provider for a session type.
+func newProvider(sessType SessionType, cfg *config.Config) (SessionProvider, error) {
+	switch sessType {
+	case SessionTypeHyprland:
+		return NewHyprland(cfg), nil
+	case SessionTypeX11Unknown:
+		return NewXorg(cfg), nil
+	case SessionTypeMacOS:
+		return NewMacOS(cfg), nil
+	case SessionTypeSway:
+		return NewSway(cfg), nil
+	case SessionTypeI3:
+		return NewI3(cfg), nil
+	case SessionTypeWayland:
+		return NewWayland(cfg), nil
+	case SessionTypeNiri:
+		return NewNiri(cfg), nil
+	case SessionTypePortal:
+		return NewPortal(cfg), nil
+	case SessionTypeCustom:
+		if !cfg.Backend.Enabled() {
+			return nil, errNoCustomBackend
+		}
+
+		return NewCustom(cfg), nil
+	default:
+		log.Warnf("Unknown session type: %d", sessType)
+		return nil, errors.New("unknown session type")
+	}
+}
+
+// setDisplays replaces the session's displays and rebuilds the lookup maps.
+func (s *Session) setDisplays(displays []Display) {
+	s.displays = displays
+	s.displayByName = make(map[string]Display, len(displays))
+	s.displayByIndex = make(map[int]Display, len(displays))
+	s.indexByName = make(map[string]int, len(displays))
 
 	// Build lookup maps with normalized user-facing indices (always 0-based)
 	for i, display := range displays {
 		userIndex := i // Always use 0-based indexing for user interface
-		session.displayByName[display.Name] = display
-		session.displayByIndex[userIndex] = display
-		session.indexByName[display.Name] = userIndex
+		s.displayByName[display.Name] = display
+		s.displayByIndex[userIndex] = display
+		s.indexByName[display.Name] = userIndex
 	}
+}
 
-	return session, nil
+// DisplayConfig returns the first display config that refers to the display
+// by index, name or description.
+func (s Session) DisplayConfig(d Display) config.DisplayConfig {
+	return displayConfig(s.cfg, d)
+}
+
+// displayConfig returns the first display config in cfg matching the
+// display.
+func displayConfig(cfg *config.Config, d Display) config.DisplayConfig {
+	for _, dc := range cfg.Displays {
+		if d.Matches(dc.Match) {
+			return dc
+		}
+	}
+
+	return config.DisplayConfig{}
+}
+
+// displaySources returns the sources for a display from its display config,
+// falling back to the configured sources.
+func (s Session) displaySources(d Display) []string {
+	if dc := s.DisplayConfig(d); len(dc.Sources) > 0 {
+		return dc.Sources
+	}
+
+	return s.cfg.Sources
 }
 
 // Config returns the session's config.
@@ -147,10 +273,15 @@ func (s Session) Config() *config.Config {
 }
 
 // getImages gets images from the sources and filters them based on the
-// blacklist and history files.
+// blacklist, invalid and history files. If the sources have no images, the
+// fallback sources are used instead.
 func (s Session) getImages(sources []string) ([]source.Image, error) {
 	log.Debugf("Getting images from sources")
 	images, err := source.GetImages(sources)
+	if err != nil && len(s.cfg.FallbackSources) > 0 {
+		log.Warnf("Error getting images: %s. Using the fallback sources", err)
+		images, err = source.GetImages(s.cfg.FallbackSources)
+	}
 	if err != nil {
 		log.Errorf("Error getting images: %s", err)
 		return nil, err
@@ -164,6 +295,14 @@ func (s Session) getImages(sources []string) ([]source.Image, error) {
 	}
 	images = source.FilterImages(images, blacklist)
 
+	log.Debugf("Filtering invalid images")
+	invalid, err := s.ReadList(s.cfg.InvalidFile)
+	if err != nil {
+		log.Errorf("Error reading invalid images: %s", err)
+		return nil, err
+	}
+	images = source.FilterImages(images, invalid)
+
 	history, err := s.ReadList(s.cfg.HistoryFile)
 	if err != nil {
 		log.Errorf("Error reading history: %s", err)
@@ -175,121 +314,16 @@ func (s Session) getImages(sources []string) ([]source.Image, error) {
 		images = source.FilterImages(images, history)
 	}
 
-	return images, nil
-}
-
-// SetWallpaper sets the wallpaper for the session.
-func (s *Session) SetWallpaper(sources []string, displayStr string) error {
-	var err error
-	if len(sources) == 0 {
-		sources = s.cfg.Sources
-	}
-
-	images, err := s.getImages(sources)
-	if err != nil {
-		return err
-	}
-
-	var display Display
-	displays := s.displays
-
-	if displayStr != "" {
-		_, display, err = s.GetDisplay(displayStr)
-		if err != nil {
-			return err
-		}
-		displays = []Display{display}
-	}
-
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(displays))
-	defer close(errChan)
-	var mu sync.Mutex
-
-	// Function to process each display
-	processDisplay := func(d Display) {
-		defer wg.Done()
-		for i := 0; i < MaxRetries; i++ {
-			var image source.Image
-			// Synchronize access to the images slice
-			mu.Lock()
-			if len(images) > 0 {
-				image, err = source.Random(images, s.cfg.CacheDir)
-			} else {
-				mu.Unlock()
-				errChan <- errors.New("no images available")
-				return
-			}
-			mu.Unlock()
-
-			if err != nil {
-				log.Errorf("Error selecting random image for display %s: %s", d.Name, err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			log.Debugf("Number of images: %d", len(images))
-
-			err = s.svc.SetWallpaper(image.Path, d)
-			if err != nil {
-				log.Errorf("Error setting wallpaper for display %s: %s. Will retry", d.Name, err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-
-			mu.Lock()
-
-			// Don't re-use the same image for multiple displays, unless there aren't
-			// enough images to go around.
-			if len(displays) <= len(images) {
-				images = source.RemoveImage(images, image)
-			}
-
-			err = s.WriteCurrent(d, image)
-			if err != nil {
-				log.Errorf("Error saving to history for display %s: %s", d.Name, err)
-				errChan <- err
-				mu.Unlock()
-				return
-			}
-
-			err = s.WriteHistory(image)
-			if err != nil {
-				log.Errorf("Error writing to history for display %s: %s", d.Name, err)
-				errChan <- err
-				mu.Unlock()
-				return
-			}
-
-			mu.Unlock()
-
-			log.Infof("Set wallpaper for display %s: %s", d.Name, image.Path)
-			return
-		}
-		errChan <- errors.New("max retries exceeded")
-	}
-
-	for _, d := range displays {
-		wg.Add(1)
-		go processDisplay(d)
+	if len(images) == 0 && len(s.cfg.FallbackSources) > 0 {
+		log.Warnf("No images are left after filtering. Using the fallback sources")
+		return source.GetImages(s.cfg.FallbackSources)
 	}
 
-	wg.Wait()
-
-	select {
-	case err = <-errChan:
-		return err
-	default:
-	}
-
-	err = s.cleanupTmpDir()
-	if err != nil {
-		log.Errorf("Error cleaning up tmp dir: %s", err)
-	}
-
-	return nil
+	return images, nil
 }
 
-// GetDisplay gets a display by index or name using O(1) map lookups.
+// GetDisplay gets a display by index or name using O(1) map lookups, falling
+// back to the monitor's description (see Display.MatchesDescription).
 func (s Session) GetDisplay(display string) (int, Display, error) {
 	// If it's a number, try both index lookup and name lookup
 	if util.IsNumber(display) {
@@ -318,6 +352,13 @@ func (s Session) GetDisplay(display string) (int, Display, error) {
 		return userIndex, d, nil
 	}
 
+	// Fall back to matching the monitor's description
+	for i, d := range s.displays {
+		if d.MatchesDescription(display) {
+			return i, d, nil
+		}
+	}
+
 	return -1, Display{}, errors.New("display not found")
 }
 
@@ -326,11 +367,11 @@ func (s Session) Displays() []Display {
 	return s.displays
 }
 
-// Display returns the display for the session by index or name.
+// Display returns the display for the session by index, name or
+// description.
 func (c CurrentWallpaper) Display(display string) (Display, error) {
 	for _, d := range c.Displays {
-		// If the display arg is a number, match the index. otherwise, match the name.
-		if strconv.Itoa(d.Index) == display || d.Name == display {
+		if d.Matches(display) {
 			return d, nil
 		}
 	}
@@ -338,6 +379,87 @@ func (c CurrentWallpaper) Display(display string) (Display, error) {
 	return Display{}, errors.New("current wallpaper not found for display")
 }
 
+// ForDisplay returns the current wallpaper state for a connected display,
+// matched by its stable identity.
+func (c CurrentWallpaper) ForDisplay(display Display) (Display, error) {
+	if i := c.find(display); i >= 0 {
+		return c.Displays[i], nil
+	}
+
+	return Display{}, errors.New("current wallpaper not found for display")
+}
+
+// find returns the position of the display's entry, or -1 if there isn't
+// one. Entries written before displays were identified by their monitor have
+// no make, model or serial, and are matched by name instead.
+func (c CurrentWallpaper) find(display Display) int {
+	for i, d := range c.Displays {
+		if d.ID() == display.ID() {
+			return i
+		}
+	}
+
+	for i, d := range c.Displays {
+		if d.Description() == "" && d.Name == display.Name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// detectSession detects the session type, preferring a custom backend from
+// the config when its detect command matches.
+func detectSession(cfg *config.Config) (SessionType, error) {
+	if detectCustom(cfg) {
+		log.Debugf("Detected custom backend")
+		return SessionTypeCustom, nil
+	}
+
+	return detect()
+}
+
+// Type returns the session type in use.
+func (s Session) Type() SessionType {
+	return s.sessType
+}
+
+// DetectedType returns the session type detected from the environment, which
+// may differ from the type in use if it was overridden.
+func (s Session) DetectedType() SessionType {
+	return s.detected
+}
+
+// SetTool returns a description of the tool used to set wallpapers.
+func (s Session) SetTool() string {
+	if s.cfg.SetCommand != "" && s.sessType != SessionTypeCustom && s.sessType != SessionTypeMacOS &&
+		s.sessType != SessionTypePortal {
+		return "set_command: " + cmdName(s.cfg.SetCommand)
+	}
+
+	_, tool := s.cfg.SessionOverride()
+	var cmds []string
+	switch s.sessType {
+	case SessionTypeHyprland, SessionTypeSway, SessionTypeNiri, SessionTypeWayland:
+		cmds = defaultWaylandSetCmds
+	case SessionTypeX11Unknown, SessionTypeI3:
+		cmds = defaultXorgSetCmds
+	case SessionTypeMacOS:
+		return "osascript"
+	case SessionTypePortal:
+		return portalWallpaper
+	case SessionTypeCustom:
+		return "backend.set: " + cmdName(s.cfg.Backend.Set)
+	}
+
+	cmd, err := findSetCmd(cmds, tool)
+	if err != nil {
+		return "(none: " + err.Error() + ")"
+	}
+
+	return cmdName(cmd)
+}
+
 // detect the current session type based on the environment and/or
 // commands.
 func detect() (SessionType, error) {
@@ -346,6 +468,8 @@ func detect() (SessionType, error) {
 	xdgCurrentDesktop := os.Getenv("XDG_CURRENT_DESKTOP")
 	xdgSessionType := os.Getenv("XDG_SESSION_TYPE")
 	swaySocket := os.Getenv("SWAYSOCK")
+	i3Socket := os.Getenv("I3SOCK")
+	niriSocket := os.Getenv("NIRI_SOCKET")
 	isMac := isMacOS()
 
 	switch {
@@ -358,12 +482,21 @@ func detect() (SessionType, error) {
 	case xdgSessionType == "wayland" && swaySocket != "":
 		log.Debugf("Detected Sway session")
 		return SessionTypeSway, nil
+	case xdgSessionType == "wayland" && niriSocket != "":
+		log.Debugf("Detected niri session")
+		return SessionTypeNiri, nil
 	case xdgSessionType == "wayland":
 		log.Debugf("Detected Wayland session")
 		return SessionTypeWayland, nil
+	case xdgSessionType == "x11" && i3Socket != "":
+		log.Debugf("Detected i3 session")
+		return SessionTypeI3, nil
 	case xdgSessionType == "x11":
 		log.Debugf("Detected X11 session")
 		return SessionTypeX11Unknown, nil
+	case hasSessionBus():
+		log.Debugf("Unknown session, using the desktop portal")
+		return SessionTypePortal, nil
 	default:
 		return SessionTypeUnknown, errors.New("unknown session type")
 	}
@@ -384,19 +517,60 @@ func parseSetCmd(cmd, path, display string) string {
 
 // getSetCmd determines and returns the set commands for the session. It
 // iterates over the default set commands until an available command is
-// found.
-func getSetCmd(l []string, path, display string) (string, error) {
+// found. If a tool is given, only that tool's command is considered.
+func getSetCmd(l []string, path, display, tool string) (string, error) {
+	cmd, err := findSetCmd(l, tool)
+	if err != nil {
+		return "", err
+	}
+
+	return parseSetCmd(cmd, path, display), nil
+}
+
+// findSetCmd returns the first set command template whose tool is available,
+// or the template for the given tool.
+func findSetCmd(l []string, tool string) (string, error) {
 	for _, cmd := range l {
-		if _, err := exec.LookPath(strings.Split(cmd, " ")[0]); err == nil {
-			cmd = parseSetCmd(cmd, path, display)
+		if tool != "" && cmdName(cmd) != tool {
+			continue
+		}
 
+		if _, err := exec.LookPath(cmdName(cmd)); err == nil {
 			return cmd, nil
 		}
 	}
 
+	if tool != "" {
+		tools := make([]string, 0, len(l))
+		for _, cmd := range l {
+			tools = append(tools, cmdName(cmd))
+		}
+
+		return "", fmt.Errorf("set tool %s is not available (supported: %s)",
+			tool, strings.Join(tools, ", "))
+	}
+
 	return "", errors.New("no set command found")
 }
 
+// ReadCurrentDisplay returns the current wallpaper state for a display
+// referenced by index, name or description. Connected displays are matched
+// by their stable identity, so the state follows a monitor across connectors.
+func (s Session) ReadCurrentDisplay(display string) (Display, error) {
+	currentFile, err := s.ReadCurrent()
+	if err != nil {
+		return Display{}, err
+	}
+
+	if _, d, err := s.GetDisplay(display); err == nil {
+		if current, err := currentFile.ForDisplay(d); err == nil {
+			return current, nil
+		}
+	}
+
+	return currentFile.Display(display)
+}
+
 // GetCurrentWallpaper gets the current wallpaper for a display.
 func (s Session) GetCurrentWallpaper(display string) (string, error) {
 	_, d, err := s.GetDisplay(display)
@@ -409,20 +583,9 @@ func (s Session) GetCurrentWallpaper(display string) (string, error) {
 		log.Fatal(err)
 	}
 
-	// Find the current display by matching the actual display struct
-	// instead of relying on CurrentWallpaper.Display which uses old logic
-	var currentDisplay Display
-	found := false
-	for _, cd := range currentFile.Displays {
-		if cd.Index == d.Index && cd.Name == d.Name {
-			currentDisplay = cd
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return "", errors.New("current wallpaper not found for display")
+	currentDisplay, err := currentFile.ForDisplay(d)
+	if err != nil {
+		return "", err
 	}
 
 	return s.svc.GetCurrentWallpaper(d, currentDisplay)
@@ -469,10 +632,9 @@ func (s Session) getViewCommand(image string) (string, error) {
 }
 
 // WriteCurrent writes the current wallpaper for a given display to the
-// s.cfg.HistoryPath file in the format of "display:path".
-// e.g. "0:/path/to/image.jpg"
-// This only updates the line for the given display, leaving the rest of the
-// file unchanged.
+// s.cfg.CurrentFile file.
+// This only updates the entry for the given display, matched by Display.ID,
+// leaving the rest of the file unchanged.
 func (s Session) WriteCurrent(display Display, path source.Image) error {
 	var err error
 	// Update the display's current path
@@ -500,16 +662,12 @@ func (s Session) WriteCurrent(display Display, path source.Image) error {
 		return fmt.Errorf("failed to unmarshal the file content: %w", err)
 	}
 
-	// Update or append the display in the current wallpaper list
-	found := false
-	for i, d := range current.Displays {
-		if d.Index == display.Index {
-			found = true
-			current.Displays[i] = display
-			break
-		}
-	}
-	if !found {
+	// Update or append the display in the current wallpaper list, keyed on the
+	// display's stable identity rather than its index. An old entry for the
+	// display is replaced by one with its identity.
+	if i := current.find(display); i >= 0 {
+		current.Displays[i] = display
+	} else {
 		current.Displays = append(current.Displays, display)
 	}
 
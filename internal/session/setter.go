@@ -0,0 +1,147 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// persistentSetter describes a wallpaper tool that keeps running to draw the
+// wallpaper, rather than handing it to a daemon and exiting.
+type persistentSetter struct {
+	// perOutput is true if an instance only draws on a single output.
+	// Otherwise a single instance draws on every output.
+	perOutput bool
+}
+
+// persistentSetters are the persistent wallpaper tools, keyed by command.
+var persistentSetters = map[string]persistentSetter{
+	"swaybg":   {perOutput: true},
+	"wbg":      {perOutput: false},
+	"mpvpaper": {perOutput: true},
+	"xwinwrap": {perOutput: true},
+}
+
+// pidFileLocks serializes replacing the instance recorded in each PID file,
+// so displays set at the same time don't stop each other's instances or
+// leave them running untracked.
+var (
+	pidFileLocksMu sync.Mutex
+	pidFileLocks   = map[string]*sync.Mutex{}
+)
+
+// pidFileNameRe matches characters that aren't safe in a PID file name.
+var pidFileNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// cmdName returns the name of the command run by a command string.
+func cmdName(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return filepath.Base(fields[0])
+}
+
+// drawsAllOutputs returns true if the command is a persistent tool that
+// draws a single image on every output.
+func drawsAllOutputs(name string) bool {
+	setter, persistent := persistentSetters[name]
+
+	return persistent && !setter.perOutput
+}
+
+// lockPIDFile locks the PID file and returns a function that unlocks it.
+func lockPIDFile(pidFile string) func() {
+	pidFileLocksMu.Lock()
+	mu, ok := pidFileLocks[pidFile]
+	if !ok {
+		mu = &sync.Mutex{}
+		pidFileLocks[pidFile] = mu
+	}
+	pidFileLocksMu.Unlock()
+
+	mu.Lock()
+
+	return mu.Unlock
+}
+
+// pidFileName returns the name of the PID file, relative to the runtime
+// directory, of a persistent tool started for a display.
+func pidFileName(name, display string) string {
+	return fmt.Sprintf("walsh/%s-%s.pid", name, pidFileNameRe.ReplaceAllString(display, "_"))
+}
+
+// runSetCmd runs a command that sets a wallpaper on a display. Persistent
+// tools are started in the background, replacing the instance previously
+// started for the display, or for every display with tools like wbg that
+// draw on all of them.
+func runSetCmd(cmd, display string) error {
+	name := cmdName(cmd)
+	setter, persistent := persistentSetters[name]
+	if !persistent {
+		_, err := util.RunCmd(cmd)
+
+		return err
+	}
+
+	if !setter.perOutput {
+		display = "all"
+	}
+
+	pidFile, err := xdg.RuntimeFile(pidFileName(name, display))
+	if err != nil {
+		return fmt.Errorf("failed to resolve PID file: %w", err)
+	}
+	defer lockPIDFile(pidFile)()
+
+	pid, err := util.StartCmd(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	// Stop the previous instance once the new one has started, so the
+	// display doesn't flash empty in between.
+	stopPIDFile(pidFile, name)
+
+	if err = os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0o600); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+
+	return nil
+}
+
+// stopPIDFile terminates the process recorded in a PID file if it's still
+// running the named command.
+func stopPIDFile(pidFile, name string) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return
+	}
+
+	// Guard against the PID having been reused by another process.
+	comm, err := util.RunCmd(fmt.Sprintf("ps -p %d -o comm=", pid))
+	if err != nil || cmdName(comm) != name {
+		return
+	}
+
+	log.Debugf("Stopping previous %s (PID %d)", name, pid)
+	if err = syscall.Kill(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		log.Warnf("Failed to stop previous %s (PID %d): %s", name, pid, err)
+	}
+}
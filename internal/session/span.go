@@ -0,0 +1,349 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/hooks"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// Spanner is implemented by session providers that can stretch a single
+// image across every display themselves.
+type Spanner interface {
+	// SpanWallpaper spans the image at path across all displays. It returns
+	// ErrSpanUnsupported if the provider's tool can't span.
+	SpanWallpaper(path string) error
+}
+
+// ErrSpanUnsupported is returned by a Spanner that can't span with the
+// current tool. The image is split into a tile per display instead.
+var ErrSpanUnsupported = errors.New("spanning is not supported")
+
+// spanWallpaper picks a single image and spans it across every display.
+func (s *Session) spanWallpaper(sources []string) error {
+	if len(sources) == 0 {
+		sources = s.cfg.Sources
+	}
+
+	images, err := s.getImages(sources)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return errNoImages
+	}
+
+	for i := 0; i < MaxRetries; i++ {
+		image, err := s.pickValid(
+			func() (source.Image, error) {
+				if len(images) == 0 {
+					return source.Image{}, errNoImages
+				}
+
+				return source.Random(images, s.cfg.CacheDir)
+			},
+			func(image source.Image) { images = source.RemoveImage(images, image) },
+		)
+		if errors.Is(err, errNoImages) {
+			return err
+		}
+		if err == nil && source.IsGenerated(image) {
+			image, err = s.generateSpanned(image)
+		}
+		if err != nil {
+			log.Errorf("Error selecting random image: %s", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		if err = s.runHooks(hooks.PreSet, "", image, nil); err != nil {
+			log.Infof("Skipping %s: %s", image.Path, err)
+			images = source.RemoveImage(images, image)
+			continue
+		}
+
+		if err = s.setSpanned(image.Path); err != nil {
+			log.Errorf("Error spanning wallpaper: %s. Will retry", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		for _, d := range s.displays {
+			if err = s.WriteCurrent(d, image); err != nil {
+				return err
+			}
+		}
+
+		if err = s.WriteHistory(image); err != nil {
+			return err
+		}
+
+		log.Infof("Spanned wallpaper across %d displays: %s", len(s.displays), image.Path)
+		for _, d := range s.displays {
+			s.notifyHooks(hooks.PostSet, d.Name, image, nil)
+		}
+
+		return nil
+	}
+
+	return errors.New("max retries exceeded")
+}
+
+// generateSpanned renders a generated image at the size of the whole
+// layout.
+func (s *Session) generateSpanned(image source.Image) (source.Image, error) {
+	width, height := 0, 0
+	if layout, err := spanLayout(s.displays, s.cfg.Span.Bezel); err == nil {
+		width, height = layout.canvas.Dx(), layout.canvas.Dy()
+	}
+
+	return source.Generate(image, width, height, s.cfg.CacheDir)
+}
+
+// setSpanned spans the image at path across the displays, natively if the
+// provider can, otherwise by setting a tile of the image on each display. The
+// image is converted first if the set tool can't display it, and processed
+// as a whole before it's handed to the provider.
+func (s *Session) setSpanned(path string) error {
+	width, height := 0, 0
+	if layout, err := spanLayout(s.displays, s.cfg.Span.Bezel); err == nil {
+		width, height = layout.canvas.Dx(), layout.canvas.Dy()
+	}
+
+	// Overlays describe the original image, not the converted copy.
+	original := path
+	path, err := s.convertWallpaper(path, width, height)
+	if err != nil {
+		return err
+	}
+
+	if spanner, ok := s.svc.(Spanner); ok {
+		err := spanner.SpanWallpaper(s.processSpanned(original, path, width, height))
+		if !errors.Is(err, ErrSpanUnsupported) {
+			return err
+		}
+		log.Debugf("Provider can't span natively, splitting the image: %s", err)
+	}
+
+	// A single display shows the whole image anyway.
+	if len(s.displays) == 1 {
+		return s.svc.SetWallpaper(path, s.displays[0])
+	}
+
+	// Tiles can't be shown by a tool that draws one image on every display,
+	// so each display shows the whole image instead.
+	if batch, ok := s.svc.(BatchSetter); ok && s.sharesImage() {
+		log.Infof("The set tool can't span, showing the whole image on every display")
+		processed := s.processSpanned(original, path, width, height)
+		paths := make(map[string]string, len(s.displays))
+		for _, d := range s.displays {
+			paths[d.Name] = processed
+		}
+
+		return batch.SetWallpapers(paths)
+	}
+
+	tiles, err := s.spanTiles(path)
+	if err != nil {
+		return err
+	}
+
+	// The tiles are already sized to each display, so only apply effects and
+	// overlays.
+	for _, d := range s.displays {
+		opts, err := s.imageOptions(original, d)
+		if err != nil {
+			log.Warnf("Not processing wallpaper for display %s: %s", d.Name, err)
+			continue
+		}
+		opts.Mode = ""
+		tiles[d.Name] = s.processWallpaper(tiles[d.Name], d, opts)
+	}
+
+	if batch, ok := s.svc.(BatchSetter); ok {
+		return batch.SetWallpapers(tiles)
+	}
+
+	for _, d := range s.displays {
+		if err = s.svc.SetWallpaper(tiles[d.Name], d); err != nil {
+			return fmt.Errorf("display %s: %w", d.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// processSpanned fits the image at path, converted from original, to the
+// size of the whole layout and applies the global effects and overlay.
+// Display configs don't apply, since the image isn't split between the
+// displays.
+func (s *Session) processSpanned(original, path string, width, height int) string {
+	d := Display{Index: -1, Name: "span", Width: width, Height: height}
+	opts, err := s.imageOptions(original, d)
+	if err != nil {
+		log.Warnf("Not processing spanned wallpaper: %s", err)
+		return path
+	}
+
+	return s.processWallpaper(path, d, opts)
+}
+
+// spanTiles crops the image at path into a tile for each display, sized to
+// the display's resolution, and writes them to the cache directory. It
+// returns the path of each tile keyed by display name. Tiles that were
+// already generated for the same image and layout are reused.
+func (s *Session) spanTiles(path string) (map[string]string, error) {
+	layout, err := spanLayout(s.displays, s.cfg.Span.Bezel)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := util.Sha256(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tilePaths := make(map[string]string, len(s.displays))
+	missing := false
+	for _, d := range s.displays {
+		tilePaths[d.Name] = filepath.Join(s.cfg.CacheDir, spanTileName(hash, layout, d))
+		if !util.FileExists(tilePaths[d.Name]) {
+			missing = true
+		}
+	}
+
+	if !missing {
+		return tilePaths, nil
+	}
+
+	img, err := imaging.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scale the canvas to cover the image, then map each display's area of
+	// the canvas onto the image.
+	canvas := layout.canvas
+	crop := imaging.CoverRect(img.Bounds(), canvas.Dx(), canvas.Dy(), imaging.FocusCenter)
+	scale := float64(crop.Dx()) / float64(canvas.Dx())
+
+	for _, d := range s.displays {
+		r := layout.rects[d.Name]
+		src := image.Rect(
+			crop.Min.X+int(math.Round(float64(r.Min.X)*scale)),
+			crop.Min.Y+int(math.Round(float64(r.Min.Y)*scale)),
+			crop.Min.X+int(math.Round(float64(r.Max.X)*scale)),
+			crop.Min.Y+int(math.Round(float64(r.Max.Y)*scale)),
+		)
+
+		tile := imaging.Resize(img, src, d.Width, d.Height)
+		if err = imaging.Save(tile, tilePaths[d.Name]); err != nil {
+			return nil, err
+		}
+		log.Debugf("Wrote span tile for display %s: %s", d.Name, tilePaths[d.Name])
+	}
+
+	return tilePaths, nil
+}
+
+// spanLayoutInfo is the area of each display within the spanned canvas.
+type spanLayoutInfo struct {
+	canvas image.Rectangle
+	rects  map[string]image.Rectangle
+}
+
+// spanLayout lays the displays out by their position and logical size, so a
+// scaled display covers the same share of the image as it does of the
+// desktop. Each column and row after the first is shifted by the bezel
+// width. The canvas is the bounding box of all displays, moved to the
+// origin.
+func spanLayout(displays []Display, bezel int) (spanLayoutInfo, error) {
+	rects := make(map[string]image.Rectangle, len(displays))
+	columns := spanOffsets(displays, func(d Display) int { return d.X }, bezel)
+	rows := spanOffsets(displays, func(d Display) int { return d.Y }, bezel)
+
+	var canvas image.Rectangle
+	for i, d := range displays {
+		if d.Width <= 0 || d.Height <= 0 {
+			return spanLayoutInfo{}, fmt.Errorf(
+				"the size of display %s is unknown, so the image can't be spanned", d.Name,
+			)
+		}
+
+		scale := d.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+
+		x, y := d.X+columns[d.X], d.Y+rows[d.Y]
+		r := image.Rect(x, y,
+			x+int(math.Round(float64(d.Width)/scale)),
+			y+int(math.Round(float64(d.Height)/scale)))
+		rects[d.Name] = r
+
+		if i == 0 {
+			canvas = r
+		} else {
+			canvas = canvas.Union(r)
+		}
+	}
+
+	for name, r := range rects {
+		rects[name] = r.Sub(canvas.Min)
+	}
+
+	return spanLayoutInfo{canvas: canvas.Sub(canvas.Min), rects: rects}, nil
+}
+
+// spanOffsets returns the bezel offset for each distinct position along one
+// axis: the nth position from the left (or top) is shifted by n bezels.
+func spanOffsets(displays []Display, pos func(Display) int, bezel int) map[int]int {
+	positions := []int{}
+	seen := map[int]bool{}
+	for _, d := range displays {
+		if p := pos(d); !seen[p] {
+			seen[p] = true
+			positions = append(positions, p)
+		}
+	}
+	sort.Ints(positions)
+
+	offsets := make(map[int]int, len(positions))
+	for i, p := range positions {
+		offsets[p] = i * bezel
+	}
+
+	return offsets
+}
+
+// spanTileName returns the cache file name for a display's tile. It's
+// derived from the image's hash and the whole layout, so a tile is only
+// reused for the same image on the same arrangement of displays.
+func spanTileName(hash string, layout spanLayoutInfo, d Display) string {
+	names := make([]string, 0, len(layout.rects))
+	for name := range layout.rects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := []string{hash}
+	for _, name := range names {
+		key = append(key, fmt.Sprintf("%s=%v", name, layout.rects[name]))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(key, "\n")))
+
+	return fmt.Sprintf("walsh-span-%s-%s-%dx%d.jpg",
+		hex.EncodeToString(sum[:6]), d.Name, d.Width, d.Height)
+}
@@ -1,67 +1,120 @@
 package session
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/charmbracelet/log"
 	"github.com/joshbeard/walsh/internal/config"
-	"github.com/joshbeard/walsh/internal/util"
 )
 
 type sway struct {
 	cfg *config.Config
 }
 
-var _ SessionProvider = sway{}
+var (
+	_ SessionProvider   = sway{}
+	_ DisplayWatcher    = sway{}
+	_ BatchSetter       = sway{}
+	_ SharedSetter      = sway{}
+	_ FormatProvider    = sway{}
+	_ AnimationProvider = sway{}
+	_ WorkspaceWatcher  = sway{}
+)
 
 func NewSway(cfg *config.Config) SessionProvider {
 	return sway{cfg: cfg}
 }
 
-// SetWallpaper sets the wallpaper for the specified display in a Hyprland
+// SetWallpaper sets the wallpaper for the specified display in a Sway
 // session.
 func (s sway) SetWallpaper(path string, display Display) error {
-	return setWaylandWallpaper(path, display, s.cfg.SetCommand)
+	return setWaylandWallpaper(path, display, s.cfg)
+}
+
+// SetWallpapers sets the wallpaper on several displays in a Sway
+// session.
+func (s sway) SetWallpapers(paths map[string]string) error {
+	return setWaylandWallpapers(paths, s.GetDisplays, s.cfg)
+}
+
+// SharesImage returns true if the set tool draws one image on every output
+// in a Sway session.
+func (s sway) SharesImage() bool {
+	return waylandSharesImage(s.cfg)
+}
+
+// Formats returns the image formats the set tool can display in
+// a Sway session.
+func (s sway) Formats() []string {
+	return setToolFormats(defaultWaylandSetCmds, s.cfg)
+}
+
+// AnimatedFormats returns the formats that can be played in a Sway session.
+func (s sway) AnimatedFormats() []string {
+	return waylandAnimatedFormats(s.cfg)
 }
 
-// GetDisplays returns a list of displays in a Hyprland session.
-// This uses the `hyprctl monitors` command to get a list of displays.
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display in a Sway session.
+func (s sway) SetAnimatedWallpaper(path string, display Display) error {
+	return setWaylandAnimated(path, display, s.cfg)
+}
+
+// GetDisplays returns a list of displays in a Sway session.
+// This queries the outputs over the IPC socket in SWAYSOCK.
 func (s sway) GetDisplays() ([]Display, error) {
-	result, err := util.RunCmd(`swaymsg -t get_outputs`)
+	ipc, err := newSwayIPC()
 	if err != nil {
-		return nil, fmt.Errorf("failed to run sway monitors: %w", err)
+		return nil, err
 	}
 
-	return s.parseDisplays(result)
+	outputs, err := ipc.GetOutputs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sway outputs: %w", err)
+	}
+
+	displays := swayOutputsToDisplays(outputs)
+	fillFromEDID(displays)
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
 }
 
-// GetCurrentWallpaper returns the current wallpaper for the specified display
-// in a Hyprland session. This uses the `swww query` command to get the current
-// wallpaper.
-func (s sway) GetCurrentWallpaper(display, _ Display) (string, error) {
-	return getSwwwWallpaper(display, Display{})
+// WatchDisplays sends on changes when Sway reports an output event.
+func (s sway) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return err
+	}
+
+	return ipc.WatchDisplays(ctx, changes)
 }
 
-func (s sway) parseDisplays(result string) ([]Display, error) {
-	jsonObj := []map[string]interface{}{}
-	err := json.Unmarshal([]byte(result), &jsonObj)
+// ActiveWorkspaces returns the workspace shown on each output in a Sway
+// session.
+func (s sway) ActiveWorkspaces() (map[string]string, error) {
+	ipc, err := newSwayIPC()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse json: %w", err)
+		return nil, err
 	}
 
-	displays := make([]Display, 0, len(jsonObj))
-	for i, value := range jsonObj {
-		name := value["name"]
+	return ipc.ActiveWorkspaces()
+}
 
-		log.Warnf("i: %d, name: %s", i, name)
-		displays = append(displays, Display{
-			Index: i,
-			Name:  name.(string),
-		})
+// WatchWorkspaces sends on changes when Sway reports a workspace event.
+func (s sway) WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error {
+	ipc, err := newSwayIPC()
+	if err != nil {
+		return err
 	}
 
-	log.Warnf("found %d displays: %+v", len(displays), displays)
+	return ipc.WatchWorkspaces(ctx, changes)
+}
 
-	return displays, nil
+// GetCurrentWallpaper returns the current wallpaper for the specified display
+// in a Sway session. This uses the `swww query` command when swww is
+// available, and otherwise the last wallpaper walsh set on the display.
+func (s sway) GetCurrentWallpaper(display, current Display) (string, error) {
+	return getWaylandWallpaper(display, current)
 }
@@ -0,0 +1,317 @@
+package session
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// i3/sway IPC message types.
+// See https://i3wm.org/docs/ipc.html and sway-ipc(7).
+const (
+	swayMsgGetWorkspaces uint32 = 1
+	swayMsgSubscribe     uint32 = 2
+	swayMsgGetOutputs    uint32 = 3
+
+	// swayEventWorkspace is sent when workspaces are focused, created or
+	// moved.
+	swayEventWorkspace uint32 = 0x80000000
+	// swayEventOutput is sent when outputs are added, removed or changed.
+	swayEventOutput uint32 = 0x80000001
+)
+
+// swayIPCMagic is the magic string that prefixes every i3/sway IPC message.
+const swayIPCMagic = "i3-ipc"
+
+// swayIPCTimeout is the deadline for a single request/response exchange.
+const swayIPCTimeout = 5 * time.Second
+
+// swayRect is a rectangle in the compositor's layout coordinates.
+type swayRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// swayMode is an output mode as reported by sway.
+type swayMode struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// swayOutput is an output as reported by GET_OUTPUTS. i3 only reports the
+// name, active state and rect; the remaining fields are sway extensions.
+type swayOutput struct {
+	Name        string   `json:"name"`
+	Make        string   `json:"make"`
+	Model       string   `json:"model"`
+	Serial      string   `json:"serial"`
+	Active      bool     `json:"active"`
+	Rect        swayRect `json:"rect"`
+	Scale       float64  `json:"scale"`
+	Transform   string   `json:"transform"`
+	CurrentMode swayMode `json:"current_mode"`
+}
+
+// swayWorkspace is a workspace as reported by GET_WORKSPACES. Visible
+// workspaces are the ones shown on their output.
+type swayWorkspace struct {
+	Name    string `json:"name"`
+	Output  string `json:"output"`
+	Visible bool   `json:"visible"`
+	Focused bool   `json:"focused"`
+}
+
+// swayIPC is a minimal client for the i3/sway IPC protocol.
+type swayIPC struct {
+	socket string
+}
+
+// newSwayIPC returns an IPC client for the socket in SWAYSOCK or I3SOCK.
+func newSwayIPC() (*swayIPC, error) {
+	socket := os.Getenv("SWAYSOCK")
+	if socket == "" {
+		socket = os.Getenv("I3SOCK")
+	}
+
+	if socket == "" {
+		return nil, errors.New("neither SWAYSOCK nor I3SOCK is set")
+	}
+
+	return &swayIPC{socket: socket}, nil
+}
+
+// request sends a single message and returns the payload of the reply.
+func (c swayIPC) request(msgType uint32, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", c.socket, swayIPCTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", c.socket, err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(swayIPCTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	if err = writeSwayMessage(conn, msgType, payload); err != nil {
+		return nil, err
+	}
+
+	replyType, reply, err := readSwayMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if replyType != msgType {
+		return nil, fmt.Errorf("unexpected reply type %d for request %d", replyType, msgType)
+	}
+
+	return reply, nil
+}
+
+// GetOutputs returns the outputs known to the compositor.
+func (c swayIPC) GetOutputs() ([]swayOutput, error) {
+	reply, err := c.request(swayMsgGetOutputs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []swayOutput
+	if err = json.Unmarshal(reply, &outputs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal outputs: %w", err)
+	}
+
+	return outputs, nil
+}
+
+// GetWorkspaces returns the workspaces known to the compositor.
+func (c swayIPC) GetWorkspaces() ([]swayWorkspace, error) {
+	reply, err := c.request(swayMsgGetWorkspaces, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaces []swayWorkspace
+	if err = json.Unmarshal(reply, &workspaces); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workspaces: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+// ActiveWorkspaces returns the name of the workspace shown on each output,
+// keyed by output name.
+func (c swayIPC) ActiveWorkspaces() (map[string]string, error) {
+	workspaces, err := c.GetWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]string, len(workspaces))
+	for _, ws := range workspaces {
+		if ws.Visible {
+			active[ws.Output] = ws.Name
+		}
+	}
+
+	return active, nil
+}
+
+// Subscribe subscribes to the given event types and calls onEvent with the
+// type and payload of every event received. It blocks until ctx is cancelled
+// or the connection fails.
+func (c swayIPC) Subscribe(
+	ctx context.Context, events []string, onEvent func(uint32, []byte),
+) error {
+	conn, err := net.DialTimeout("unix", c.socket, swayIPCTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.socket, err)
+	}
+	defer conn.Close()
+
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	if err = writeSwayMessage(conn, swayMsgSubscribe, payload); err != nil {
+		return err
+	}
+
+	_, reply, err := readSwayMessage(conn)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err = json.Unmarshal(reply, &result); err != nil {
+		return fmt.Errorf("failed to unmarshal subscribe reply: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("failed to subscribe to %v", events)
+	}
+
+	// Unblock the read below when the context is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		msgType, msg, err := readSwayMessage(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		onEvent(msgType, msg)
+	}
+}
+
+// WatchDisplays sends on changes whenever an output event is received.
+func (c swayIPC) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	return c.Subscribe(ctx, []string{"output"}, func(msgType uint32, _ []byte) {
+		if msgType == swayEventOutput {
+			notifyChange(changes)
+		}
+	})
+}
+
+// WatchWorkspaces sends on changes whenever a workspace event is received.
+func (c swayIPC) WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error {
+	return c.Subscribe(ctx, []string{"workspace"}, func(msgType uint32, _ []byte) {
+		if msgType == swayEventWorkspace {
+			notifyChange(changes)
+		}
+	})
+}
+
+// writeSwayMessage writes a message using the i3 IPC framing:
+// "i3-ipc" <payload length> <message type> <payload>, with both integers in
+// native (little-endian) byte order.
+func writeSwayMessage(w io.Writer, msgType uint32, payload []byte) error {
+	buf := make([]byte, 0, len(swayIPCMagic)+8+len(payload))
+	buf = append(buf, swayIPCMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload))) // #nosec G115
+	buf = binary.LittleEndian.AppendUint32(buf, msgType)
+	buf = append(buf, payload...)
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write IPC message: %w", err)
+	}
+
+	return nil
+}
+
+// readSwayMessage reads a single framed message and returns its type and
+// payload.
+func readSwayMessage(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, len(swayIPCMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, fmt.Errorf("failed to read IPC header: %w", err)
+	}
+
+	if string(header[:len(swayIPCMagic)]) != swayIPCMagic {
+		return 0, nil, errors.New("invalid IPC magic")
+	}
+
+	length := binary.LittleEndian.Uint32(header[len(swayIPCMagic):])
+	msgType := binary.LittleEndian.Uint32(header[len(swayIPCMagic)+4:])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read IPC payload: %w", err)
+	}
+
+	return msgType, payload, nil
+}
+
+// swayOutputsToDisplays converts active outputs to displays.
+func swayOutputsToDisplays(outputs []swayOutput) []Display {
+	displays := make([]Display, 0, len(outputs))
+	for _, output := range outputs {
+		if !output.Active {
+			continue
+		}
+
+		scale := output.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+
+		transform := transformNames[output.Transform]
+		width, height := output.CurrentMode.Width, output.CurrentMode.Height
+		if width == 0 || height == 0 {
+			// i3 doesn't report modes; the rect is in physical pixels there.
+			width, height = output.Rect.Width, output.Rect.Height
+		} else if transform%2 == 1 {
+			width, height = height, width
+		}
+
+		displays = append(displays, Display{
+			Index:     len(displays),
+			Name:      output.Name,
+			Make:      unknownToEmpty(output.Make),
+			Model:     unknownToEmpty(output.Model),
+			Serial:    unknownToEmpty(output.Serial),
+			X:         output.Rect.X,
+			Y:         output.Rect.Y,
+			Width:     width,
+			Height:    height,
+			Scale:     scale,
+			Transform: transform,
+		})
+	}
+
+	return displays
+}
@@ -0,0 +1,173 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSwayMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType uint32
+		payload []byte
+	}{
+		{name: "empty payload", msgType: swayMsgGetOutputs, payload: []byte{}},
+		{name: "subscribe", msgType: swayMsgSubscribe, payload: []byte(`["output"]`)},
+		{name: "event", msgType: swayEventOutput, payload: []byte(`{"change":"unspecified"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSwayMessage(&buf, tt.msgType, tt.payload); err != nil {
+				t.Fatalf("writeSwayMessage: %v", err)
+			}
+
+			if got := buf.Len(); got != len(swayIPCMagic)+8+len(tt.payload) {
+				t.Fatalf("message length = %d, want %d", got, len(swayIPCMagic)+8+len(tt.payload))
+			}
+
+			msgType, payload, err := readSwayMessage(&buf)
+			if err != nil {
+				t.Fatalf("readSwayMessage: %v", err)
+			}
+			if msgType != tt.msgType {
+				t.Errorf("type = %#x, want %#x", msgType, tt.msgType)
+			}
+			if !bytes.Equal(payload, tt.payload) {
+				t.Errorf("payload = %q, want %q", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestReadSwayMessageErrors(t *testing.T) {
+	header := func(magic string, length uint32) []byte {
+		b := []byte(magic)
+		b = binary.LittleEndian.AppendUint32(b, length)
+		return binary.LittleEndian.AppendUint32(b, swayMsgGetOutputs)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "short header", input: []byte("i3-ipc")},
+		{name: "bad magic", input: header("i3-xxx", 0)},
+		{name: "short payload", input: append(header(swayIPCMagic, 10), "[]"...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readSwayMessage(bytes.NewReader(tt.input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// fakeSwayServer serves a single request on a Unix socket, replying with
+// replyType and reply, and returns the socket path. The type of the request
+// received is sent on requests.
+func fakeSwayServer(t *testing.T, replyType uint32, reply string) (string, <-chan uint32) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "sway.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan uint32, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		msgType, _, err := readSwayMessage(conn)
+		if err != nil {
+			return
+		}
+		requests <- msgType
+
+		_ = writeSwayMessage(conn, replyType, []byte(reply))
+	}()
+
+	return socket, requests
+}
+
+func TestGetOutputs(t *testing.T) {
+	reply := `[
+		{"name": "eDP-1", "make": "BOE", "model": "0x095F", "serial": "Unknown",
+		 "active": true, "rect": {"x": 0, "y": 0, "width": 1280, "height": 800},
+		 "scale": 1.5, "transform": "normal",
+		 "current_mode": {"width": 1920, "height": 1200}},
+		{"name": "DP-1", "make": "Dell Inc.", "model": "U2720Q", "serial": "ABC123",
+		 "active": true, "rect": {"x": 1280, "y": 0, "width": 1080, "height": 1920},
+		 "scale": 2, "transform": "90",
+		 "current_mode": {"width": 3840, "height": 2160}},
+		{"name": "HDMI-A-1", "active": false}
+	]`
+
+	socket, requests := fakeSwayServer(t, swayMsgGetOutputs, reply)
+	ipc := swayIPC{socket: socket}
+
+	outputs, err := ipc.GetOutputs()
+	if err != nil {
+		t.Fatalf("GetOutputs: %v", err)
+	}
+	if got := <-requests; got != swayMsgGetOutputs {
+		t.Errorf("request type = %d, want %d", got, swayMsgGetOutputs)
+	}
+	if len(outputs) != 3 {
+		t.Fatalf("got %d outputs, want 3", len(outputs))
+	}
+
+	want := []Display{
+		{
+			Index: 0, Name: "eDP-1", Make: "BOE", Model: "0x095F",
+			X: 0, Y: 0, Width: 1920, Height: 1200, Scale: 1.5,
+		},
+		{
+			Index: 1, Name: "DP-1", Make: "Dell Inc.", Model: "U2720Q", Serial: "ABC123",
+			X: 1280, Y: 0, Width: 2160, Height: 3840, Scale: 2, Transform: 1,
+		},
+	}
+	if got := swayOutputsToDisplays(outputs); !reflect.DeepEqual(got, want) {
+		t.Errorf("displays = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetOutputsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		replyType uint32
+		reply     string
+	}{
+		{name: "wrong reply type", replyType: swayMsgSubscribe, reply: `[]`},
+		{name: "invalid json", replyType: swayMsgGetOutputs, reply: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket, _ := fakeSwayServer(t, tt.replyType, tt.reply)
+			if _, err := (swayIPC{socket: socket}).GetOutputs(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	t.Run("no server", func(t *testing.T) {
+		ipc := swayIPC{socket: filepath.Join(t.TempDir(), "missing.sock")}
+		if _, err := ipc.GetOutputs(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/theme"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// themeDisplay returns the display whose wallpaper the theme is generated
+// from: the configured theme display, or the first display.
+func (s Session) themeDisplay() (Display, error) {
+	if s.cfg.Theme.Display != "" {
+		_, d, err := s.GetDisplay(s.cfg.Theme.Display)
+		if err != nil {
+			return Display{}, fmt.Errorf("theme display %s: %w", s.cfg.Theme.Display, err)
+		}
+
+		return d, nil
+	}
+
+	if len(s.displays) == 0 {
+		return Display{}, errors.New("no displays found")
+	}
+
+	return s.displays[0], nil
+}
+
+// UpdateTheme generates a palette from the image at path, or from the
+// current wallpaper of the display if path is empty, renders the theme
+// templates with it and runs the reload commands. An empty display is the
+// theme display.
+func (s Session) UpdateTheme(display, path string) (theme.Palette, error) {
+	var d Display
+	var err error
+	if display != "" {
+		_, d, err = s.GetDisplay(display)
+	} else {
+		d, err = s.themeDisplay()
+	}
+	if err != nil {
+		return theme.Palette{}, err
+	}
+
+	if path == "" {
+		current, err := s.ReadCurrent()
+		if err != nil {
+			return theme.Palette{}, err
+		}
+
+		cur, err := current.ForDisplay(d)
+		if err != nil || cur.Current.Path == "" {
+			return theme.Palette{}, fmt.Errorf("no wallpaper recorded for display %s", d.Name)
+		}
+		path = cur.Current.Path
+	}
+
+	// Videos and formats walsh can't decode are themed by their first frame
+	// or a converted copy.
+	decodable, err := s.decodableImage(path, d.Width, d.Height)
+	if err != nil {
+		return theme.Palette{}, err
+	}
+
+	palette, err := theme.Cached(decodable, s.cfg.CacheDir, s.cfg.Theme.Light)
+	if err != nil {
+		return theme.Palette{}, fmt.Errorf("failed to extract palette: %w", err)
+	}
+	palette.Wallpaper = path
+
+	var renderErr error
+	for _, t := range s.cfg.Theme.Templates {
+		tmpl, out := os.ExpandEnv(t.Template), os.ExpandEnv(t.Output)
+		if err = theme.Render(palette, tmpl, out); err != nil {
+			log.Errorf("Error rendering theme template %s: %s", tmpl, err)
+			renderErr = errors.Join(renderErr, err)
+			continue
+		}
+		log.Debugf("Rendered theme template %s to %s", tmpl, out)
+	}
+
+	for _, cmd := range s.cfg.Theme.Reload {
+		if out, err := util.RunCmd(cmd); err != nil {
+			log.Errorf("Error running theme reload command %q: %s: %s", cmd, err, out)
+		}
+	}
+
+	return palette, renderErr
+}
+
+// refreshTheme updates the theme after wallpapers have been set, if theming
+// is enabled and the theme display was one of them.
+func (s Session) refreshTheme(displays []Display) {
+	if !s.cfg.Theme.Enabled {
+		return
+	}
+
+	d, err := s.themeDisplay()
+	if err != nil {
+		log.Errorf("Error updating theme: %s", err)
+		return
+	}
+
+	for _, set := range displays {
+		if set.Name != d.Name {
+			continue
+		}
+
+		if _, err = s.UpdateTheme("", ""); err != nil {
+			log.Errorf("Error updating theme: %s", err)
+		} else {
+			log.Infof("Updated theme from display %s", d.Name)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/joshbeard/walsh/internal/config"
+)
+
+// transitionArgs build the command line arguments for a transition, keyed
+// by the set tool that takes them. Tools that aren't listed don't show
+// transitions.
+var transitionArgs = map[string]func(config.TransitionConfig) []string{
+	"swww": swwwTransitionArgs,
+}
+
+// displayTransition returns the transition for a display, with the
+// display's config overriding the transitions config.
+func displayTransition(cfg *config.Config, d Display) config.TransitionConfig {
+	return cfg.Transitions.Merge(displayConfig(cfg, d).Transitions)
+}
+
+// withTransition appends the arguments for a transition to a set command,
+// if its tool supports transitions.
+func withTransition(cmd string, t config.TransitionConfig) string {
+	build, ok := transitionArgs[cmdName(cmd)]
+	if !ok {
+		return cmd
+	}
+
+	args := build(t)
+	if len(args) == 0 {
+		return cmd
+	}
+
+	return cmd + " " + strings.Join(args, " ")
+}
+
+// transitionType returns the type of transition to show. A random type is
+// chosen from the transition's Random list, if it has one.
+func transitionType(t config.TransitionConfig) string {
+	if strings.EqualFold(t.Type, "random") && len(t.Random) > 0 {
+		return t.Random[rand.Intn(len(t.Random))]
+	}
+
+	return t.Type
+}
+
+// swwwTransitionArgs returns the `swww img` arguments for a transition.
+func swwwTransitionArgs(t config.TransitionConfig) []string {
+	var args []string
+	if typ := transitionType(t); typ != "" {
+		args = append(args, "--transition-type", "'"+typ+"'")
+	}
+	if t.Duration > 0 {
+		args = append(args, "--transition-duration", strconv.FormatFloat(t.Duration, 'f', -1, 64))
+	}
+	if t.FPS > 0 {
+		args = append(args, "--transition-fps", strconv.Itoa(t.FPS))
+	}
+	if t.Step > 0 {
+		args = append(args, "--transition-step", strconv.Itoa(t.Step))
+	}
+	if t.Angle != nil {
+		args = append(args, "--transition-angle", strconv.FormatFloat(*t.Angle, 'f', -1, 64))
+	}
+	if t.Position != "" {
+		args = append(args, "--transition-pos", "'"+t.Position+"'")
+	}
+	if t.Bezier != "" {
+		args = append(args, "--transition-bezier", "'"+t.Bezier+"'")
+	}
+
+	return args
+}
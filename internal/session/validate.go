@@ -0,0 +1,147 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// checkImage makes sure an image can be set. Images that can't are recorded
+// in the invalid list, and moved to the quarantine directory if one is
+// configured, so they aren't selected again. Generated images and collages
+// are made by walsh, so they aren't checked.
+func (s Session) checkImage(image source.Image) error {
+	if source.IsGenerated(image) || image.Source == collageSource {
+		return nil
+	}
+
+	err := source.Check(image.Path)
+
+	var checkErr *source.CheckError
+	if errors.As(err, &checkErr) && checkErr.Usable() {
+		log.Debugf("Setting image despite problem: %s", err)
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Skipping bad image %s", err)
+		if rejectErr := s.RejectImage(image); rejectErr != nil {
+			log.Errorf("Error rejecting image %s: %s", image.Path, rejectErr)
+		}
+	}
+
+	return err
+}
+
+// pickValid calls pick until it returns an image that passes checkImage.
+// Bad images are passed to discard so they aren't picked again.
+func (s Session) pickValid(pick func() (source.Image, error), discard func(source.Image)) (source.Image, error) {
+	for {
+		image, err := pick()
+		if err != nil {
+			return image, err
+		}
+
+		if s.checkImage(image) == nil {
+			return image, nil
+		}
+		discard(image)
+	}
+}
+
+// RejectImage adds a bad image to the invalid list so it's excluded from
+// selection. If a quarantine directory is configured, local images are moved
+// there.
+func (s Session) RejectImage(image source.Image) error {
+	if err := s.WriteList(s.cfg.InvalidFile, image); err != nil {
+		return err
+	}
+
+	// Images from SSH sources are temporary copies, so there's nothing to
+	// move.
+	if s.cfg.QuarantineDir == "" || strings.HasPrefix(image.Source, source.SourceSSH.String()) {
+		return nil
+	}
+
+	if !util.FileExists(s.cfg.QuarantineDir) {
+		if err := util.MkDir(s.cfg.QuarantineDir); err != nil {
+			return err
+		}
+	}
+
+	dest := filepath.Join(s.cfg.QuarantineDir, filepath.Base(image.Path))
+	if util.FileExists(dest) {
+		dest = filepath.Join(s.cfg.QuarantineDir,
+			fmt.Sprintf("%s-%s", image.ShaSum[:8], filepath.Base(image.Path)))
+	}
+
+	if err := os.Rename(image.Path, dest); err != nil {
+		return fmt.Errorf("failed to quarantine %s: %w", image.Path, err)
+	}
+	log.Warnf("Moved %s to %s", image.Path, dest)
+
+	return nil
+}
+
+// BadImage is an image that failed a check.
+type BadImage struct {
+	source.Image
+	Err *source.CheckError
+}
+
+// CheckSources checks every local image in the sources and returns the
+// number checked and the ones with problems. If no sources are given, the
+// configured sources, the displays' sources and the fallback sources are
+// checked. Files listed by more than one source are checked once, and images
+// from SSH sources and generated sources are skipped.
+func (s Session) CheckSources(sources []string) (int, []BadImage, error) {
+	if len(sources) == 0 {
+		sources = s.allSources()
+	}
+
+	images, err := source.GetImages(sources)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	checked := 0
+	var bad []BadImage
+	for _, image := range source.UniqueImages(images) {
+		if image.Path == "" || source.IsGenerated(image) ||
+			strings.HasPrefix(image.Source, source.SourceSSH.String()) {
+			continue
+		}
+		checked++
+
+		var checkErr *source.CheckError
+		if err := source.Check(image.Path); errors.As(err, &checkErr) {
+			bad = append(bad, BadImage{Image: image, Err: checkErr})
+		}
+	}
+
+	return checked, bad, nil
+}
+
+// allSources returns the configured sources, the displays' sources and the
+// fallback sources without duplicates.
+func (s Session) allSources() []string {
+	all := append([]string{}, s.cfg.Sources...)
+	for _, d := range s.cfg.Displays {
+		all = append(all, d.Sources...)
+	}
+	all = append(all, s.cfg.FallbackSources...)
+
+	var sources []string
+	for _, src := range all {
+		if !util.Contains(sources, src) {
+			sources = append(sources, src)
+		}
+	}
+
+	return sources
+}
@@ -0,0 +1,508 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/hooks"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// errNoImages is returned when a display's sources have no images left.
+var errNoImages = errors.New("no images available")
+
+// imagePools holds the images each display can choose from. Displays sharing
+// the same sources draw from the same pool.
+type imagePools struct {
+	mu       sync.Mutex
+	pools    map[string][]source.Image
+	keys     map[string]string
+	displays int
+	cacheDir string
+
+	// claimed holds the images chosen for each display so far, so
+	// near-duplicates aren't shown side by side. A negative threshold allows
+	// them.
+	index     *imageIndex
+	threshold int
+	claimed   []claim
+
+	// reserved holds the images picked for displays in a batch that hasn't
+	// been set yet, keyed by pool, so other displays don't pick them too.
+	reserved map[string][]source.Image
+}
+
+// claim is an image chosen for a display and its hash.
+type claim struct {
+	display string
+	shaSum  string
+	hash    uint64
+}
+
+// newImagePools loads the images for each display. If no sources are given,
+// each display uses the sources from its display config or the configured
+// sources.
+func (s *Session) newImagePools(sources []string, displays []Display) (*imagePools, error) {
+	p := &imagePools{
+		pools:    make(map[string][]source.Image),
+		keys:     make(map[string]string, len(displays)),
+		displays: len(displays),
+		cacheDir: s.cfg.CacheDir,
+
+		index:     loadIndex(s.cfg.IndexFile),
+		threshold: s.cfg.NearDuplicateThreshold(),
+	}
+
+	for _, d := range displays {
+		srcs := sources
+		if len(srcs) == 0 {
+			srcs = s.displaySources(d)
+		}
+
+		key := strings.Join(srcs, "\n")
+		p.keys[d.Name] = key
+		if _, exists := p.pools[key]; exists {
+			continue
+		}
+
+		images, err := s.getImages(srcs)
+		if err != nil {
+			return nil, err
+		}
+		p.pools[key] = images
+	}
+
+	return p, nil
+}
+
+// pick selects a random image from a display's pool. Generated images are
+// rendered at the display's resolution.
+func (p *imagePools) pick(d Display) (source.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	images := p.available(p.keys[d.Name])
+	if len(images) == 0 {
+		return source.Image{}, errNoImages
+	}
+
+	image, err := source.Random(images, p.cacheDir)
+	if err != nil || !source.IsGenerated(image) {
+		return image, err
+	}
+
+	return source.Generate(image, d.Width, d.Height, p.cacheDir)
+}
+
+// available returns the images in a pool that aren't reserved, or all of
+// them if they're all reserved.
+func (p *imagePools) available(key string) []source.Image {
+	images := p.pools[key]
+	for _, img := range p.reserved[key] {
+		images = source.RemoveImage(images, img)
+	}
+	if len(images) == 0 {
+		return p.pools[key]
+	}
+
+	return images
+}
+
+// reserve keeps an image, or the images in a collage, from being picked for
+// another display until the reservations are released.
+func (p *imagePools) reserve(d Display, image source.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.reserved == nil {
+		p.reserved = make(map[string][]source.Image)
+	}
+	key := p.keys[d.Name]
+	p.reserved[key] = append(p.reserved[key], image.Images()...)
+}
+
+// release releases every reservation.
+func (p *imagePools) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reserved = nil
+}
+
+// discard removes a bad image from a display's pool.
+func (p *imagePools) discard(d Display, image source.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.keys[d.Name]
+	p.pools[key] = source.RemoveImage(p.pools[key], image)
+}
+
+// use removes an image, or the images in a collage, from a display's pool so
+// it isn't re-used for another display, unless there aren't enough images to
+// go around.
+func (p *imagePools) use(d Display, image source.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.keys[d.Name]
+	for _, img := range image.Images() {
+		if p.displays <= len(p.pools[key]) {
+			p.pools[key] = source.RemoveImage(p.pools[key], img)
+		}
+	}
+}
+
+// claim records an image as chosen for a display, unless it's a
+// near-duplicate of an image already chosen. Choosing the same image for the
+// same display again is allowed, for retries. Images that can't be hashed are
+// allowed.
+func (p *imagePools) claim(d Display, image source.Image) bool {
+	if p.threshold < 0 || source.IsGenerated(image) || image.Source == collageSource {
+		return true
+	}
+
+	hash, err := p.index.hash(image)
+	if err != nil {
+		log.Debugf("Not checking %s for duplicates: %s", image.Path, err)
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range p.claimed {
+		if c.display == d.Name && c.shaSum == image.ShaSum {
+			return true
+		}
+		if imaging.HashDistance(hash, c.hash) <= p.threshold {
+			return false
+		}
+	}
+	p.claimed = append(p.claimed, claim{display: d.Name, shaSum: image.ShaSum, hash: hash})
+
+	return true
+}
+
+// SetWallpaper sets the wallpaper for the session. If no sources are given,
+// each display uses the sources from its display config or the configured
+// sources. Providers that implement BatchSetter set every display in a
+// single call; otherwise each display is set independently. With span set
+// and no display given, one image is spanned across every display. The
+// on_error hooks are run if it fails.
+func (s *Session) SetWallpaper(sources []string, displayStr string, span bool) (err error) {
+	defer func() {
+		if err != nil {
+			s.notifyHooks(hooks.Error, displayStr, source.Image{}, err)
+		}
+	}()
+
+	displays := s.displays
+
+	if span && displayStr == "" {
+		err = s.spanWallpaper(sources)
+		if err != nil {
+			return err
+		}
+		s.refreshTheme(s.displays)
+		s.refreshLockscreen()
+
+		if err = s.cleanupTmpDir(); err != nil {
+			log.Errorf("Error cleaning up tmp dir: %s", err)
+		}
+
+		return nil
+	}
+
+	if displayStr != "" {
+		var display Display
+		_, display, err = s.GetDisplay(displayStr)
+		if err != nil {
+			return err
+		}
+		displays = []Display{display}
+	}
+
+	// Tools like wbg draw one image on every display, so every display is
+	// set, with the image picked for the first.
+	if s.sharesImage() {
+		first := displays[0]
+		displays = []Display{first}
+		for _, d := range s.displays {
+			if d.Name != first.Name {
+				displays = append(displays, d)
+			}
+		}
+	}
+
+	pools, err := s.newImagePools(sources, displays)
+	if err != nil {
+		return err
+	}
+	s.claimCurrent(pools, displays)
+
+	if batch, ok := s.svc.(BatchSetter); ok {
+		err = s.setWallpapersBatch(batch, displays, pools)
+	} else {
+		err = s.setWallpapersEach(displays, pools)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = pools.index.save(); err != nil {
+		log.Errorf("Error saving image index: %s", err)
+	}
+
+	s.refreshTheme(displays)
+	s.refreshLockscreen()
+
+	err = s.cleanupTmpDir()
+	if err != nil {
+		log.Errorf("Error cleaning up tmp dir: %s", err)
+	}
+
+	return nil
+}
+
+// setWallpapersEach sets the wallpaper for each display concurrently, one
+// provider call per display.
+func (s *Session) setWallpapersEach(displays []Display, pools *imagePools) error {
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(displays))
+	var mu sync.Mutex
+
+	// Function to process each display
+	processDisplay := func(d Display) {
+		defer wg.Done()
+		for i := 0; i < MaxRetries; i++ {
+			image, err := s.pickImage(pools, d)
+			if errors.Is(err, errNoImages) {
+				errChan <- err
+				return
+			}
+			if err != nil {
+				log.Errorf("Error selecting random image for display %s: %s", d.Name, err)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			err = s.setDisplayWallpaper(image.Path, d)
+			if err != nil {
+				log.Errorf("Error setting wallpaper for display %s: %s. Will retry", d.Name, err)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			pools.use(d, image)
+
+			// Synchronize access to the current and history files
+			mu.Lock()
+			err = s.recordWallpaper(d, image)
+			mu.Unlock()
+			if err != nil {
+				errChan <- err
+			}
+
+			return
+		}
+		errChan <- errors.New("max retries exceeded")
+	}
+
+	for _, d := range displays {
+		wg.Add(1)
+		go processDisplay(d)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	return <-errChan
+}
+
+// setWallpapersBatch picks an image for every display and sets them all in
+// a single provider call. When only some displays are being set, the others
+// keep their current wallpaper, since batch tools replace every display. If
+// the set tool draws one image on every display, they're all given the first
+// display's image.
+func (s *Session) setWallpapersBatch(
+	batch BatchSetter, displays []Display, pools *imagePools,
+) error {
+	shared := s.sharesImage()
+	for i := 0; i < MaxRetries; i++ {
+		paths := s.otherWallpapers(displays)
+		images := make(map[string]source.Image, len(displays))
+
+		var err error
+		for n, d := range displays {
+			if shared && n > 0 {
+				first := displays[0].Name
+				images[d.Name], paths[d.Name] = images[first], paths[first]
+				continue
+			}
+
+			var image source.Image
+			image, err = s.pickImage(pools, d)
+			if err != nil {
+				break
+			}
+
+			// Reserve the image right away so the next display doesn't pick
+			// it too. It's only used up once the batch has been set.
+			pools.reserve(d, image)
+			images[d.Name] = image
+			paths[d.Name] = s.prepareWallpaper(image.Path, d)
+		}
+		if err == nil {
+			err = batch.SetWallpapers(paths)
+		}
+		pools.release()
+
+		if errors.Is(err, errNoImages) || errors.Is(err, errNotPerDisplay) {
+			return err
+		}
+		if err != nil {
+			log.Errorf("Error setting wallpapers: %s. Will retry", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		for _, d := range displays {
+			pools.use(d, images[d.Name])
+		}
+
+		// Animated images and videos are set to their first frame with the
+		// rest, then played over it.
+		originals := make(map[string]string, len(images))
+		for name, image := range images {
+			originals[name] = image.Path
+		}
+		s.playAnimated(displays, originals)
+
+		for n, d := range displays {
+			record := s.recordWallpaper
+			if shared && n > 0 {
+				// The shared image is only added to the history once.
+				record = s.recordCurrent
+			}
+			if err = record(d, images[d.Name]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return errors.New("max retries exceeded")
+}
+
+// sharesImage returns true if there are several displays and the provider's
+// set tool draws one image on all of them.
+func (s Session) sharesImage() bool {
+	shared, ok := s.svc.(SharedSetter)
+
+	return ok && len(s.displays) > 1 && shared.SharesImage()
+}
+
+// claimCurrent claims the current wallpapers of the displays that aren't in
+// displays, so the new wallpapers aren't near-duplicates of them.
+func (s *Session) claimCurrent(pools *imagePools, displays []Display) {
+	if len(displays) == len(s.displays) {
+		return
+	}
+
+	current, err := s.ReadCurrent()
+	if err != nil {
+		return
+	}
+
+	setting := make(map[string]bool, len(displays))
+	for _, d := range displays {
+		setting[d.Name] = true
+	}
+
+	for _, d := range s.displays {
+		if setting[d.Name] {
+			continue
+		}
+
+		cur, err := current.ForDisplay(d)
+		if err != nil {
+			continue
+		}
+		for _, image := range cur.Current.Images() {
+			if util.FileExists(image.Path) {
+				pools.claim(d, image)
+			}
+		}
+	}
+}
+
+// otherWallpapers returns the current wallpaper of each display that isn't
+// in displays, prepared for the display and keyed by display name. Displays
+// without a recorded wallpaper, or whose image no longer exists, are left
+// out.
+func (s *Session) otherWallpapers(displays []Display) map[string]string {
+	paths := make(map[string]string, len(s.displays))
+	if len(displays) == len(s.displays) {
+		return paths
+	}
+
+	current, err := s.ReadCurrent()
+	if err != nil {
+		log.Warnf("Error reading current wallpapers: %s", err)
+		return paths
+	}
+
+	setting := make(map[string]bool, len(displays))
+	for _, d := range displays {
+		setting[d.Name] = true
+	}
+
+	for _, d := range s.displays {
+		if setting[d.Name] {
+			continue
+		}
+
+		cur, err := current.ForDisplay(d)
+		if err != nil || !util.FileExists(cur.Current.Path) {
+			continue
+		}
+		paths[d.Name] = s.prepareWallpaper(cur.Current.Path, d)
+	}
+
+	return paths
+}
+
+// recordWallpaper saves an image as the display's current wallpaper and adds
+// it to the history.
+func (s *Session) recordWallpaper(d Display, image source.Image) error {
+	// Collages are recorded as the images they're made from.
+	for _, img := range image.Images() {
+		if err := s.WriteHistory(img); err != nil {
+			log.Errorf("Error writing to history for display %s: %s", d.Name, err)
+			return err
+		}
+	}
+
+	return s.recordCurrent(d, image)
+}
+
+// recordCurrent saves an image as the display's current wallpaper without
+// adding it to the history.
+func (s *Session) recordCurrent(d Display, image source.Image) error {
+	if err := s.WriteCurrent(d, image); err != nil {
+		log.Errorf("Error saving to history for display %s: %s", d.Name, err)
+		return err
+	}
+
+	log.Infof("Set wallpaper for display %s: %s", d.Name, image.Path)
+	s.notifyHooks(hooks.PostSet, d.Name, image, nil)
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// hotplugSettleTime is how long to wait for further display events before
+// re-querying the displays. Connecting a dock usually produces a burst of
+// events, and compositors may not have configured a new output immediately.
+const hotplugSettleTime = time.Second
+
+// The delay before reconnecting to a provider's event source after it fails
+// starts at watchMinBackoff and doubles up to watchMaxBackoff.
+const (
+	watchMinBackoff = time.Second
+	watchMaxBackoff = time.Minute
+)
+
+// DisplayWatcher is implemented by session providers that can report when
+// displays are connected or disconnected.
+type DisplayWatcher interface {
+	// WatchDisplays sends on changes whenever the set of displays may have
+	// changed. It blocks until ctx is cancelled or the event source fails.
+	WatchDisplays(ctx context.Context, changes chan<- struct{}) error
+}
+
+// ErrWatchUnsupported is returned when the session provider can't report
+// display changes.
+var ErrWatchUnsupported = errors.New("display hotplug events are not supported by this session")
+
+// RefreshDisplays queries the displays again and rebuilds the lookup maps.
+// It returns the displays that weren't present before.
+func (s *Session) RefreshDisplays() ([]Display, error) {
+	displays, err := s.svc.GetDisplays()
+	if err != nil {
+		return nil, fmt.Errorf("error getting displays: %w", err)
+	}
+
+	var added []Display
+	for _, d := range displays {
+		if _, exists := s.displayByName[d.Name]; !exists {
+			added = append(added, d)
+		}
+	}
+
+	s.setDisplays(displays)
+
+	return added, nil
+}
+
+// WatchDisplays watches for displays being connected or disconnected and
+// calls onAdded with any newly connected displays. If the provider's event
+// source fails, e.g. when the compositor is reloaded, it's reconnected. It
+// blocks until ctx is cancelled.
+func (s *Session) WatchDisplays(ctx context.Context, onAdded func([]Display)) error {
+	watcher, ok := s.svc.(DisplayWatcher)
+	if !ok {
+		return ErrWatchUnsupported
+	}
+
+	changes := make(chan struct{}, 1)
+	reconnecting := false
+	go watchEvents(ctx, "display", func(ctx context.Context) error {
+		// Displays may have changed while the event source was down.
+		if reconnecting {
+			notifyChange(changes)
+		}
+		reconnecting = true
+
+		return watcher.WatchDisplays(ctx, changes)
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		}
+
+		// Let the burst of events settle before querying the displays.
+		settle := time.After(hotplugSettleTime)
+	drain:
+		for {
+			select {
+			case <-changes:
+			case <-settle:
+				break drain
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		added, err := s.RefreshDisplays()
+		if err != nil {
+			log.Errorf("Error refreshing displays: %s", err)
+			continue
+		}
+
+		log.Infof("Displays changed: %d connected, %d new", len(s.displays), len(added))
+		if len(added) > 0 {
+			onAdded(added)
+		}
+	}
+}
+
+// watchEvents runs watch until ctx is cancelled, running it again after a
+// delay whenever the event source fails or closes. The delay grows with each
+// failure, and is reset once an event source has stayed up for longer than
+// the longest delay.
+func watchEvents(ctx context.Context, name string, watch func(context.Context) error) {
+	backoff := watchMinBackoff
+	for {
+		started := time.Now()
+		err := watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			err = errors.New("event source closed")
+		}
+		if time.Since(started) > watchMaxBackoff {
+			backoff = watchMinBackoff
+		}
+		log.Warnf("Lost %s events: %s. Reconnecting in %v", name, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, watchMaxBackoff)
+	}
+}
+
+// notifyChange sends on changes without blocking if a change is already
+// pending.
+func notifyChange(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
@@ -1,16 +1,156 @@
 package session
 
 import (
+	"encoding/json"
 	"fmt"
+	"os/exec"
 	"strings"
 
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/config"
 	"github.com/joshbeard/walsh/internal/util"
 )
 
+// wayland is a generic Wayland session for wlroots-based compositors, such
+// as river, labwc and wayfire. Outputs are queried with wlr-randr and
+// wallpapers are set with whichever of swww, swaybg or wbg is available.
+type wayland struct {
+	cfg *config.Config
+}
+
+var (
+	_ SessionProvider   = &wayland{}
+	_ BatchSetter       = &wayland{}
+	_ SharedSetter      = &wayland{}
+	_ FormatProvider    = &wayland{}
+	_ AnimationProvider = &wayland{}
+)
+
+func NewWayland(cfg *config.Config) SessionProvider {
+	return &wayland{cfg: cfg}
+}
+
+// wlrOutput is an output as reported by `wlr-randr --json`.
+type wlrOutput struct {
+	Name    string `json:"name"`
+	Make    string `json:"make"`
+	Model   string `json:"model"`
+	Serial  string `json:"serial"`
+	Enabled bool   `json:"enabled"`
+	Modes   []struct {
+		Width   int  `json:"width"`
+		Height  int  `json:"height"`
+		Current bool `json:"current"`
+	} `json:"modes"`
+	Position struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	} `json:"position"`
+	Transform string  `json:"transform"`
+	Scale     float64 `json:"scale"`
+}
+
+// SetWallpaper sets the wallpaper for the specified display.
+func (w wayland) SetWallpaper(path string, display Display) error {
+	return setWaylandWallpaper(path, display, w.cfg)
+}
+
+// SetWallpapers sets the wallpaper on several displays.
+func (w wayland) SetWallpapers(paths map[string]string) error {
+	return setWaylandWallpapers(paths, w.GetDisplays, w.cfg)
+}
+
+// SharesImage returns true if the set tool draws one image on every output.
+func (w wayland) SharesImage() bool {
+	return waylandSharesImage(w.cfg)
+}
+
+// Formats returns the image formats the set tool can display in
+// a Wayland session.
+func (w wayland) Formats() []string {
+	return setToolFormats(defaultWaylandSetCmds, w.cfg)
+}
+
+// AnimatedFormats returns the formats that can be played in a Wayland session.
+func (w wayland) AnimatedFormats() []string {
+	return waylandAnimatedFormats(w.cfg)
+}
+
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display in a Wayland session.
+func (w wayland) SetAnimatedWallpaper(path string, display Display) error {
+	return setWaylandAnimated(path, display, w.cfg)
+}
+
+// GetDisplays returns the enabled outputs reported by `wlr-randr --json`.
+func (w wayland) GetDisplays() ([]Display, error) {
+	result, err := util.RunCmd("wlr-randr --json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run wlr-randr: %w", err)
+	}
+
+	return w.parseDisplays(result)
+}
+
+// GetCurrentWallpaper returns the current wallpaper for the specified
+// display.
+func (w wayland) GetCurrentWallpaper(display, current Display) (string, error) {
+	return getWaylandWallpaper(display, current)
+}
+
+func (w wayland) parseDisplays(output string) ([]Display, error) {
+	var outputs []wlrOutput
+	if err := json.Unmarshal([]byte(output), &outputs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wlr-randr output: %w", err)
+	}
+
+	displays := make([]Display, 0, len(outputs))
+	for _, output := range outputs {
+		if !output.Enabled {
+			continue
+		}
+
+		scale := output.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+
+		transform := transformNames[output.Transform]
+		var width, height int
+		for _, mode := range output.Modes {
+			if mode.Current {
+				width, height = mode.Width, mode.Height
+			}
+		}
+		if transform%2 == 1 {
+			width, height = height, width
+		}
+
+		displays = append(displays, Display{
+			Index:     len(displays),
+			Name:      output.Name,
+			Make:      unknownToEmpty(output.Make),
+			Model:     unknownToEmpty(output.Model),
+			Serial:    unknownToEmpty(output.Serial),
+			X:         output.Position.X,
+			Y:         output.Position.Y,
+			Width:     width,
+			Height:    height,
+			Scale:     scale,
+			Transform: transform,
+		})
+	}
+
+	log.Debugf("found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
+}
+
 var defaultWaylandSetCmds = []string{
 	`swww img '{{path}}' --outputs '{{display}}'`,
+	`swaybg --output '{{display}}' --image '{{path}}' --mode fill`,
+	`wbg '{{path}}'`,
 	// `hyprctl hyprpaper wallpaper "{{display}},{{path}}"`,
-	// `swaybg -i '{{path}}' --output '{{display}}'`,
 }
 
 // findDisplayLine finds the line in the `swww query` output that
@@ -25,6 +165,25 @@ func findDisplayLine(output, displayName string) (string, error) {
 	return "", fmt.Errorf("no wallpaper found for display %s", displayName)
 }
 
+// getWaylandWallpaper returns the current wallpaper for a display. This asks
+// swww when it's available, and otherwise returns the last wallpaper walsh
+// set on the display.
+func getWaylandWallpaper(display, current Display) (string, error) {
+	if _, err := exec.LookPath("swww"); err == nil {
+		path, err := getSwwwWallpaper(display, current)
+		if err == nil {
+			return path, nil
+		}
+		log.Debugf("Could not query swww: %s", err)
+	}
+
+	if current.Current.Path == "" {
+		return "", fmt.Errorf("no wallpaper found for display %s", display.Name)
+	}
+
+	return current.Current.Path, nil
+}
+
 func getSwwwWallpaper(display, _ Display) (string, error) {
 	result, err := util.RunCmd("swww query")
 	if err != nil {
@@ -46,21 +205,112 @@ func getSwwwWallpaper(display, _ Display) (string, error) {
 	return strings.TrimSpace(parts[1]), nil
 }
 
-func setWaylandWallpaper(path string, display Display, customCmd string) error {
+func setWaylandWallpaper(path string, display Display, cfg *config.Config) error {
 	var err error
 	cmd := ""
-	if customCmd != "" {
-		cmd = parseSetCmd(customCmd, path, display.Name)
+	if cfg.SetCommand != "" {
+		cmd = parseSetCmd(cfg.SetCommand, path, display.Name)
 	} else {
-		cmd, err = getSetCmd(defaultWaylandSetCmds, path, display.Name)
+		_, tool := cfg.SessionOverride()
+		cmd, err = getSetCmd(defaultWaylandSetCmds, path, display.Name, tool)
 		if err != nil {
 			return fmt.Errorf("error getting wallpaper set command: %w", err)
 		}
+		cmd = withTransition(cmd, displayTransition(cfg, display))
 	}
 
-	if _, err = util.RunCmd(cmd); err != nil {
+	if err = runSetCmd(cmd, display.Name); err != nil {
 		return fmt.Errorf("error setting wallpaper: %w", err)
 	}
 
 	return nil
 }
+
+// waylandSharesImage returns true if the configured set tool draws one image
+// on every output, like wbg.
+func waylandSharesImage(cfg *config.Config) bool {
+	if cfg.SetCommand != "" {
+		return drawsAllOutputs(cmdName(cfg.SetCommand))
+	}
+
+	_, tool := cfg.SessionOverride()
+	tmpl, err := findSetCmd(defaultWaylandSetCmds, tool)
+
+	return err == nil && drawsAllOutputs(cmdName(tmpl))
+}
+
+// setWaylandWallpapers sets the wallpaper on several displays. swww is run
+// once per image and transition, with every display showing it in
+// --outputs, and wbg once for every display. Other tools are run once per
+// display. getDisplays is used to match the displays against their display
+// configs.
+func setWaylandWallpapers(
+	paths map[string]string, getDisplays func() ([]Display, error), cfg *config.Config,
+) error {
+	displays := waylandDisplays(paths, getDisplays, cfg)
+	setOne := func(path, display string) error {
+		return setWaylandWallpaper(path, displays[display], cfg)
+	}
+
+	if cfg.SetCommand != "" {
+		if name := cmdName(cfg.SetCommand); drawsAllOutputs(name) {
+			return setAllOutputs(name, paths, setOne)
+		}
+
+		return setEach(paths, setOne)
+	}
+
+	_, tool := cfg.SessionOverride()
+	tmpl, err := findSetCmd(defaultWaylandSetCmds, tool)
+	if err != nil {
+		return fmt.Errorf("error getting wallpaper set command: %w", err)
+	}
+
+	if name := cmdName(tmpl); drawsAllOutputs(name) {
+		return setAllOutputs(name, paths, setOne)
+	}
+
+	if cmdName(tmpl) == "swww" {
+		transitions := make(map[string]config.TransitionConfig, len(displays))
+		for name, d := range displays {
+			transitions[name] = displayTransition(cfg, d)
+		}
+
+		if err = runBatchCmds(swwwBatchCmds(tmpl, paths, transitions)); err != nil {
+			return fmt.Errorf("error setting wallpaper: %w", err)
+		}
+
+		return nil
+	}
+
+	return setEach(paths, setOne)
+}
+
+// waylandDisplays returns the display for each name in paths. The displays
+// are only queried if there are display configs to match them against.
+func waylandDisplays(
+	paths map[string]string, getDisplays func() ([]Display, error), cfg *config.Config,
+) map[string]Display {
+	displays := make(map[string]Display, len(paths))
+	for name := range paths {
+		// An index that can't match, since only the name is known.
+		displays[name] = Display{Index: -1, Name: name}
+	}
+	if len(cfg.Displays) == 0 {
+		return displays
+	}
+
+	all, err := getDisplays()
+	if err != nil {
+		log.Warnf("Error getting displays, matching display configs by name: %s", err)
+		return displays
+	}
+
+	for _, d := range all {
+		if _, ok := displays[d.Name]; ok {
+			displays[d.Name] = d
+		}
+	}
+
+	return displays
+}
@@ -0,0 +1,295 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/hooks"
+	"github.com/joshbeard/walsh/internal/source"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// workspaceSettleTime is how long to wait after a recalled wallpaper is shown
+// before refreshing the lock screen and theme, so they aren't regenerated for
+// every workspace passed through on the way to another.
+const workspaceSettleTime = 2 * time.Second
+
+// WorkspaceWatcher is implemented by session providers that can report the
+// workspace shown on each display.
+type WorkspaceWatcher interface {
+	// ActiveWorkspaces returns the name of the workspace shown on each
+	// display, keyed by display name.
+	ActiveWorkspaces() (map[string]string, error)
+
+	// WatchWorkspaces sends on changes whenever the workspace shown on a
+	// display may have changed. It blocks until ctx is cancelled or the event
+	// source fails.
+	WatchWorkspaces(ctx context.Context, changes chan<- struct{}) error
+}
+
+// ErrWorkspacesUnsupported is returned when the session provider can't
+// report workspace switches.
+var ErrWorkspacesUnsupported = errors.New("workspace events are not supported by this session")
+
+// workspaceState is the wallpaper recorded for each workspace, keyed by
+// display ID and then workspace name.
+type workspaceState map[string]map[string]source.Image
+
+// workspacesFile returns the path of the file workspace wallpapers are
+// recorded in.
+func (s Session) workspacesFile() string {
+	if s.cfg.Workspaces.State != "" {
+		return os.ExpandEnv(s.cfg.Workspaces.State)
+	}
+
+	return filepath.Join(xdg.DataHome, "walsh", "workspaces.json")
+}
+
+// readWorkspaces reads the recorded workspace wallpapers.
+func (s Session) readWorkspaces() (workspaceState, error) {
+	state := workspaceState{}
+
+	file := s.workspacesFile()
+	if !util.FileExists(file) {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspaces: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workspaces: %w", err)
+	}
+
+	return state, nil
+}
+
+// writeWorkspaces writes the recorded workspace wallpapers.
+func (s Session) writeWorkspaces(state workspaceState) error {
+	file := s.workspacesFile()
+	if err := util.MkDir(filepath.Dir(file)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal workspaces: %w", err)
+	}
+
+	if err = os.WriteFile(file, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write workspaces: %w", err)
+	}
+
+	return nil
+}
+
+// ResetWorkspaces forgets the wallpapers recorded for every workspace, so
+// new ones are picked as each workspace is shown.
+func (s Session) ResetWorkspaces() error {
+	err := os.Remove(s.workspacesFile())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove workspaces: %w", err)
+	}
+
+	return nil
+}
+
+// WatchWorkspaces sets the wallpaper for the workspace shown on each
+// display, then again whenever another workspace is shown. Each workspace
+// keeps the wallpaper it was first given on a display, so switching back to
+// it shows the same image. If the provider's event source fails, e.g. when
+// the compositor is reloaded, it's reconnected. It blocks until ctx is
+// cancelled.
+func (s *Session) WatchWorkspaces(ctx context.Context) error {
+	watcher, ok := s.svc.(WorkspaceWatcher)
+	if !ok {
+		return ErrWorkspacesUnsupported
+	}
+
+	changes := make(chan struct{}, 1)
+	go watchEvents(ctx, "workspace", func(ctx context.Context) error {
+		// Start with the workspaces that are already shown, which may also
+		// have changed while the event source was down.
+		notifyChange(changes)
+
+		return watcher.WatchWorkspaces(ctx, changes)
+	})
+
+	shown := map[string]string{}
+	var recalled []Display
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-settle:
+			s.refreshTheme(recalled)
+			s.refreshLockscreen()
+			recalled, settle = nil, nil
+			continue
+		case <-changes:
+		}
+
+		active, err := watcher.ActiveWorkspaces()
+		if err != nil {
+			log.Errorf("Error getting active workspaces: %s", err)
+			continue
+		}
+
+		for name, workspace := range active {
+			if shown[name] == workspace {
+				continue
+			}
+
+			d, err := s.workspaceDisplay(name)
+			if err != nil {
+				log.Errorf("Error setting wallpaper for workspace %s: %s", workspace, err)
+				continue
+			}
+
+			// Keep whatever the previous workspace was showing, in case
+			// its wallpaper was changed while it was shown.
+			if prev := shown[name]; prev != "" {
+				if err = s.rememberWorkspace(d, prev); err != nil {
+					log.Errorf("Error recording wallpaper for workspace %s: %s", prev, err)
+				}
+			}
+
+			wasRecalled, err := s.showWorkspace(d, workspace)
+			if err != nil {
+				log.Errorf("Error setting wallpaper for workspace %s on display %s: %s",
+					workspace, d.Name, err)
+				continue
+			}
+			shown[name] = workspace
+
+			if wasRecalled {
+				recalled = append(recalled, d)
+				settle = time.After(workspaceSettleTime)
+			}
+		}
+	}
+}
+
+// workspaceDisplay returns the display with the given name, querying the
+// displays again if it has just been connected.
+func (s *Session) workspaceDisplay(name string) (Display, error) {
+	if d, ok := s.displayByName[name]; ok {
+		return d, nil
+	}
+
+	if _, err := s.RefreshDisplays(); err != nil {
+		return Display{}, err
+	}
+
+	d, ok := s.displayByName[name]
+	if !ok {
+		return Display{}, fmt.Errorf("display %s not found", name)
+	}
+
+	return d, nil
+}
+
+// showWorkspace sets the wallpaper recorded for a workspace on a display,
+// returning true if there was one. If there isn't, or its image is gone or
+// has been blacklisted, a new one is picked from the workspace's sources and
+// recorded.
+func (s *Session) showWorkspace(d Display, workspace string) (bool, error) {
+	state, err := s.readWorkspaces()
+	if err != nil {
+		return false, err
+	}
+
+	if image, ok := state[d.ID()][workspace]; ok {
+		if s.workspaceImageAvailable(image) {
+			log.Infof("Showing workspace %s on display %s", workspace, d.Name)
+			return true, s.showImage(d, image)
+		}
+		log.Infof("The wallpaper for workspace %s on display %s is no longer available",
+			workspace, d.Name)
+	}
+
+	log.Infof("Picking a wallpaper for workspace %s on display %s", workspace, d.Name)
+	if err = s.SetWallpaper(s.cfg.Workspaces.Sources[workspace], d.Name, false); err != nil {
+		return false, err
+	}
+
+	return false, s.rememberWorkspace(d, workspace)
+}
+
+// rememberWorkspace records the display's current wallpaper as the one for
+// the workspace.
+func (s *Session) rememberWorkspace(d Display, workspace string) error {
+	current, err := s.ReadCurrent()
+	if err != nil {
+		return err
+	}
+
+	cur, err := current.ForDisplay(d)
+	if err != nil {
+		return err
+	}
+
+	state, err := s.readWorkspaces()
+	if err != nil {
+		return err
+	}
+
+	if state[d.ID()] == nil {
+		state[d.ID()] = map[string]source.Image{}
+	}
+	state[d.ID()][workspace] = cur.Current
+
+	return s.writeWorkspaces(state)
+}
+
+// workspaceImageAvailable returns true if a recorded image still exists and
+// hasn't been blacklisted since.
+func (s Session) workspaceImageAvailable(image source.Image) bool {
+	if !util.FileExists(image.Path) {
+		return false
+	}
+
+	blacklist, err := s.ReadList(s.cfg.BlacklistFile)
+	if err != nil {
+		log.Warnf("Error reading blacklist: %s", err)
+		return true
+	}
+
+	return !source.ImageInList(image, blacklist)
+}
+
+// showImage sets a specific image on a display and records it as the
+// display's current wallpaper. It isn't added to the history again, since
+// it wasn't picked. Batch providers are given the other displays' current
+// wallpapers too, since they replace every display. The lock screen and
+// theme are left for the caller to refresh.
+func (s *Session) showImage(d Display, image source.Image) error {
+	if batch, ok := s.svc.(BatchSetter); ok {
+		paths := s.otherWallpapers([]Display{d})
+		paths[d.Name] = s.prepareWallpaper(image.Path, d)
+		if err := batch.SetWallpapers(paths); err != nil {
+			return err
+		}
+		s.playAnimated([]Display{d}, map[string]string{d.Name: image.Path})
+	} else if err := s.setDisplayWallpaper(image.Path, d); err != nil {
+		return err
+	}
+
+	if err := s.WriteCurrent(d, image); err != nil {
+		return err
+	}
+	log.Infof("Set wallpaper for display %s: %s", d.Name, image.Path)
+	s.notifyHooks(hooks.PostSet, d.Name, image, nil)
+
+	return nil
+}
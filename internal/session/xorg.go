@@ -3,7 +3,13 @@ package session
 // TODO: xorg support
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -15,7 +21,14 @@ type xorg struct {
 	cfg *config.Config
 }
 
-var _ SessionProvider = &xorg{}
+var (
+	_ SessionProvider   = &xorg{}
+	_ DisplayWatcher    = &xorg{}
+	_ BatchSetter       = &xorg{}
+	_ Spanner           = &xorg{}
+	_ FormatProvider    = &xorg{}
+	_ AnimationProvider = &xorg{}
+)
 
 var defaultXorgSetCmds = []string{
 	`nitrogen --head={{display}} --set-zoom-fill -- '{{path}}'`,
@@ -39,7 +52,8 @@ func (x xorg) SetWallpaper(path string, display Display) error {
 		return nil
 	}
 
-	cmd, err := getSetCmd(defaultXorgSetCmds, path, display.Name)
+	_, tool := x.cfg.SessionOverride()
+	cmd, err := getSetCmd(defaultXorgSetCmds, path, display.Name, tool)
 	if err != nil {
 		return err
 	}
@@ -52,29 +66,200 @@ func (x xorg) SetWallpaper(path string, display Display) error {
 	return nil
 }
 
+// SetWallpapers sets the wallpaper on several displays. feh sets every head
+// in a single invocation, since each run replaces the whole root window.
+// Other tools, such as nitrogen with --head, only touch the given head and
+// are run once per display.
+func (x xorg) SetWallpapers(paths map[string]string) error {
+	setOne := func(path, display string) error {
+		return x.SetWallpaper(path, Display{Name: display})
+	}
+
+	if x.cfg.SetCommand != "" {
+		return setEach(paths, setOne)
+	}
+
+	_, tool := x.cfg.SessionOverride()
+	tmpl, err := findSetCmd(defaultXorgSetCmds, tool)
+	if err != nil {
+		return err
+	}
+
+	if cmdName(tmpl) == "feh" {
+		if cmd, ok := fehBatchCmd(paths); ok {
+			_, err = util.RunCmd(cmd)
+
+			return err
+		}
+		log.Warnf("feh can only set heads %s together when every head from 0 up has an image; "+
+			"setting them one at a time, so each replaces the last", strings.Join(sortedDisplayNames(paths), ", "))
+	}
+
+	return setEach(paths, setOne)
+}
+
+// SpanWallpaper spans the image across all heads with feh, which treats the
+// screen as a single area with --no-xinerama. Other tools can't span.
+func (x xorg) SpanWallpaper(path string) error {
+	if x.cfg.SetCommand != "" {
+		return ErrSpanUnsupported
+	}
+
+	_, tool := x.cfg.SessionOverride()
+	tmpl, err := findSetCmd(defaultXorgSetCmds, tool)
+	if err != nil {
+		return err
+	}
+
+	if cmdName(tmpl) != "feh" {
+		return ErrSpanUnsupported
+	}
+
+	_, err = util.RunCmd("feh --bg-fill --no-xinerama '" + path + "'")
+
+	return err
+}
+
+// Formats returns the image formats the set tool can display. xwallpaper
+// only reads JPEG and PNG, and none of the tools read WebP.
+func (x xorg) Formats() []string {
+	return setToolFormats(defaultXorgSetCmds, x.cfg)
+}
+
+// AnimatedFormats returns the formats that can be played with xwinwrap and
+// mpv.
+func (x xorg) AnimatedFormats() []string {
+	return playerFormats(defaultXorgAnimatedCmds)
+}
+
+// SetAnimatedWallpaper plays an animated image or video on the specified
+// display.
+func (x xorg) SetAnimatedWallpaper(path string, display Display) error {
+	return setXorgAnimated(path, display)
+}
+
+// xrandrMonitorRe matches a monitor line from `xrandr --listactivemonitors`,
+// e.g. " 0: +*eDP-1 1920/344x1080/194+0+0  eDP-1".
+var xrandrMonitorRe = regexp.MustCompile(
+	`^\s*(\d+):\s+\S+\s+(\d+)/\d+x(\d+)/\d+\+(-?\d+)\+(-?\d+)\s+(\S+)`,
+)
+
+// GetDisplays returns the active monitors reported by xrandr. Displays are
+// named by their head index, which is how the Xorg wallpaper tools address
+// them, and identified by the EDID of the monitor on each output.
 func (x xorg) GetDisplays() ([]Display, error) {
-	cmd := `xrandr --listactivemonitors | grep "^ " | awk '{print $1}' | cut -d':' -f1`
-	results, err := util.RunCmd(cmd)
+	results, err := util.RunCmd("xrandr --listactivemonitors")
 	if err != nil {
 		return nil, err
 	}
 
-	// Trim any leading/trailing whitespace
-	results = strings.TrimSpace(results)
+	edids, err := xrandrEDIDs()
+	if err != nil {
+		log.Debugf("Could not read EDIDs from xrandr: %s", err)
+	}
 
-	// Results in slice by splitting on newline
-	lines := strings.Split(results, "\n")
+	displays := parseXrandrMonitors(results, edids)
 
+	log.Debugf("Found %d displays: %+v", len(displays), displays)
+
+	return displays, nil
+}
+
+// parseXrandrMonitors parses the output of `xrandr --listactivemonitors`.
+func parseXrandrMonitors(output string, edids map[string]edidInfo) []Display {
 	var displays []Display
-	for i := range lines {
-		displays = append(displays, Display{Index: i, Name: fmt.Sprintf("%d", i)})
+	for _, line := range strings.Split(output, "\n") {
+		match := xrandrMonitorRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		width, _ := strconv.Atoi(match[2])
+		height, _ := strconv.Atoi(match[3])
+		posX, _ := strconv.Atoi(match[4])
+		posY, _ := strconv.Atoi(match[5])
+		info := edids[match[6]]
+
+		i := len(displays)
+		displays = append(displays, Display{
+			Index:  i,
+			Name:   fmt.Sprintf("%d", i),
+			Make:   info.Make,
+			Model:  info.Model,
+			Serial: info.Serial,
+			X:      posX,
+			Y:      posY,
+			Width:  width,
+			Height: height,
+			Scale:  1,
+		})
 	}
 
-	log.Debugf("Found %d displays: %+v", len(displays), displays)
+	return displays
+}
 
-	return displays, nil
+// xrandrHeads returns the head index of each active output, keyed by output
+// name, from `xrandr --listactivemonitors`.
+func xrandrHeads() (map[string]int, error) {
+	results, err := util.RunCmd("xrandr --listactivemonitors")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseXrandrHeads(results), nil
+}
+
+// parseXrandrHeads parses the head index of each output from the output of
+// `xrandr --listactivemonitors`, numbered the same way as
+// parseXrandrMonitors.
+func parseXrandrHeads(output string) map[string]int {
+	heads := map[string]int{}
+	for _, line := range strings.Split(output, "\n") {
+		if match := xrandrMonitorRe.FindStringSubmatch(line); match != nil {
+			heads[match[6]] = len(heads)
+		}
+	}
+
+	return heads
 }
 
 func (x xorg) GetCurrentWallpaper(display, current Display) (string, error) {
 	return current.Current.Path, nil
 }
+
+// WatchDisplays sends on changes when XRandR reports a screen or output
+// change. The notifications on the root window are streamed from `xev`.
+func (x xorg) WatchDisplays(ctx context.Context, changes chan<- struct{}) error {
+	if _, err := exec.LookPath("xev"); err != nil {
+		return fmt.Errorf("xev is required to watch for display changes: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "xev", "-root", "-event", "randr")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get xev output: %w", err)
+	}
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start xev: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "RRScreenChangeNotify") || strings.HasPrefix(line, "RRNotify") {
+			notifyChange(changes)
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("xev exited: %w", err)
+	}
+
+	return errors.New("xev exited")
+}
@@ -0,0 +1,23 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseXrandrHeads(t *testing.T) {
+	output := `Monitors: 3
+ 0: +*DP-1 2560/597x1440/336+1920+0  DP-1
+ 1: +eDP-1 1920/344x1080/194+0+0  eDP-1
+ 2: +HDMI-1 1280/300x1024/200+4480+0  HDMI-1
+`
+
+	want := map[string]int{"DP-1": 0, "eDP-1": 1, "HDMI-1": 2}
+	if got := parseXrandrHeads(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("heads = %v, want %v", got, want)
+	}
+
+	if got := parseXrandrHeads("Monitors: 0\n"); len(got) != 0 {
+		t.Errorf("heads = %v, want none", got)
+	}
+}
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// defaultGenWidth and defaultGenHeight are the size of generated images for
+// displays whose resolution is unknown.
+const (
+	defaultGenWidth  = 1920
+	defaultGenHeight = 1080
+)
+
+// getGenImages returns a single placeholder image for a gen:// source. The
+// image is rendered by Generate once the display it's for is known.
+func getGenImages(src string) ([]Image, error) {
+	if _, err := imaging.ParseGenerator(src); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(src))
+
+	return []Image{{
+		Source: src,
+		Path:   src,
+		ShaSum: hex.EncodeToString(sum[:]),
+	}}, nil
+}
+
+// IsGenerated returns true if the image is a gen:// placeholder that has to
+// be rendered with Generate.
+func IsGenerated(image Image) bool {
+	return image.Path == image.Source && strings.HasPrefix(image.Source, SourceGen.String())
+}
+
+// Generate renders a gen:// placeholder image at width x height into dir and
+// returns the rendered image. Generators without a seed get a new one each
+// time, so they render a different image each time.
+func Generate(image Image, width, height int, dir string) (Image, error) {
+	g, err := imaging.ParseGenerator(image.Source)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if !g.HasSeed {
+		g.Seed = time.Now().UnixNano()
+	}
+
+	if width <= 0 || height <= 0 {
+		width, height = defaultGenWidth, defaultGenHeight
+	}
+
+	if !util.FileExists(dir) {
+		if err = os.Mkdir(dir, 0o700); err != nil {
+			return Image{}, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", image.Source, g.Seed)))
+	dest := filepath.Join(dir, fmt.Sprintf("walsh-gen-%s-%dx%d.png",
+		hex.EncodeToString(sum[:8]), width, height))
+
+	if !util.FileExists(dest) {
+		if err = imaging.Save(g.Generate(width, height), dest); err != nil {
+			return Image{}, err
+		}
+	}
+
+	checksum, err := util.Sha256(dest)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	return Image{Source: image.Source, Path: dest, ShaSum: checksum}, nil
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
 	"github.com/joshbeard/walsh/internal/util"
 )
 
@@ -29,6 +30,19 @@ type Image struct {
 	Source string
 	Path   string
 	ShaSum string
+
+	// Parts are the images a collage was made from.
+	Parts []Image `json:",omitempty"`
+}
+
+// Images returns the images a collage was made from, or the image itself if
+// it isn't a collage.
+func (i Image) Images() []Image {
+	if len(i.Parts) > 0 {
+		return i.Parts
+	}
+
+	return []Image{i}
 }
 
 type SourceType int
@@ -37,12 +51,14 @@ const (
 	SourceDirectory SourceType = iota
 	SourceList
 	SourceSSH
+	SourceGen
 )
 
 var sourcePrefixes = map[SourceType]string{
 	SourceDirectory: "dir://",
 	SourceList:      "list://",
 	SourceSSH:       "ssh://",
+	SourceGen:       "gen://",
 }
 
 func (st SourceType) String() string {
@@ -70,6 +86,8 @@ func GetImages(srcs []string) ([]Image, error) {
 			results, err = getDirImages(src)
 		case strings.HasPrefix(src, SourceList.String()):
 			results, err = getListImages(src)
+		case strings.HasPrefix(src, SourceGen.String()):
+			results, err = getGenImages(src)
 		case util.IsFilePath(src):
 			results, err = getDirImages(src)
 		default:
@@ -126,13 +144,15 @@ func Random(images []Image, tmpDir string) (Image, error) {
 
 // isImageFile checks if a file has a valid image extension.
 func isImageFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff":
-		return true
-	default:
-		return false
-	}
+	return imaging.IsImageExtension(filename)
+}
+
+// hasImageContent checks if a local file is an image by its contents, for
+// images without a known extension.
+func hasImageContent(path string) bool {
+	format, err := imaging.SniffFile(path)
+
+	return err == nil && format != ""
 }
 
 // getDirImages retrieves a list of images from a local directory and
@@ -160,15 +180,16 @@ func getDirImages(src string) ([]Image, error) {
 	var images []Image
 	for _, entry := range entries {
 		if !entry.IsDir() {
-			if isImageFile(entry.Name()) {
-				checksum, err := util.Sha256(filepath.Join(dirPath, entry.Name()))
+			path := filepath.Join(dirPath, entry.Name())
+			if isImageFile(entry.Name()) || hasImageContent(path) {
+				checksum, err := util.Sha256(path)
 				if err != nil {
 					return nil, fmt.Errorf("failed to calculate checksum: %w", err)
 				}
 
 				images = append(images, Image{
 					Source: SourceDirectory.String(),
-					Path:   filepath.Join(dirPath, entry.Name()),
+					Path:   path,
 					ShaSum: checksum,
 				})
 			}
@@ -436,13 +457,47 @@ func GetMatches(images []Image, list []Image) []Image {
 	return matches
 }
 
+// UniqueImages returns the images without repeats of the same file, which
+// sources that overlap list more than once. Images without a local path,
+// such as those from SSH sources, are kept as they are.
+func UniqueImages(images []Image) []Image {
+	seen := make(map[string]bool, len(images))
+	unique := make([]Image, 0, len(images))
+	for _, image := range images {
+		if image.Path != "" {
+			path := filepath.Clean(image.Path)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+		}
+		unique = append(unique, image)
+	}
+
+	return unique
+}
+
+// RemoveImage returns list without image.
 func RemoveImage(list []Image, image Image) []Image {
 	var newList []Image
 	for _, i := range list {
-		if i.ShaSum != image.ShaSum {
+		if !sameImage(i, image) {
 			newList = append(newList, i)
 		}
 	}
 
 	return newList
 }
+
+// sameImage returns true if a and b are the same image. Images from SSH
+// sources have no checksum until they're downloaded, so they're matched by
+// their source instead when either is missing one.
+func sameImage(a, b Image) bool {
+	ssh := SourceSSH.String()
+	if strings.HasPrefix(a.Source, ssh) && strings.HasPrefix(b.Source, ssh) &&
+		(a.ShaSum == "" || b.ShaSum == "") {
+		return a.Source == b.Source
+	}
+
+	return a.ShaSum == b.ShaSum
+}
@@ -0,0 +1,97 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/joshbeard/walsh/internal/imaging"
+)
+
+// Problems found when checking an image file.
+const (
+	ProblemEmpty      = "empty"
+	ProblemNotImage   = "not an image"
+	ProblemCorrupt    = "corrupt"
+	ProblemMislabeled = "mislabeled"
+	ProblemUnreadable = "unreadable"
+)
+
+// CheckError describes a problem with an image file.
+type CheckError struct {
+	Path    string
+	Problem string
+	Err     error
+}
+
+func (e *CheckError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Path, e.Problem)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", e.Path, e.Problem, e.Err)
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// Usable returns true if the image can still be set despite the problem.
+// Mislabeled images decode fine, they just have the wrong extension.
+func (e *CheckError) Usable() bool {
+	return e.Problem == ProblemMislabeled
+}
+
+// Check makes sure the file at path is an image that can be decoded. Its
+// contents are sniffed rather than trusting the extension, so truncated
+// downloads and error pages saved as images are caught. It returns a
+// *CheckError describing the problem, if there is one.
+func Check(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return &CheckError{Path: path, Problem: ProblemUnreadable, Err: err}
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return &CheckError{Path: path, Problem: ProblemUnreadable, Err: err}
+	}
+	header = header[:n]
+
+	if n == 0 {
+		return &CheckError{Path: path, Problem: ProblemEmpty}
+	}
+
+	format := imaging.Sniff(header)
+	if format == "" {
+		return &CheckError{
+			Path:    path,
+			Problem: ProblemNotImage,
+			Err:     fmt.Errorf("the file contains %s", http.DetectContentType(header)),
+		}
+	}
+
+	// Formats walsh can't decode, including videos and animated WebP images,
+	// are converted by an external tool when they're set, so they can only
+	// be sniffed here.
+	animated, _ := imaging.IsAnimated(path)
+	if imaging.Decodable(format) && (format != "webp" || !animated) {
+		if err = imaging.Verify(path); err != nil {
+			return &CheckError{Path: path, Problem: ProblemCorrupt, Err: err}
+		}
+	}
+
+	if !imaging.MatchesExtension(path, format) {
+		return &CheckError{
+			Path:    path,
+			Problem: ProblemMislabeled,
+			Err:     fmt.Errorf("the file is a %s image", format),
+		}
+	}
+
+	return nil
+}
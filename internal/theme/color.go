@@ -0,0 +1,145 @@
+package theme
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/joshbeard/walsh/internal/imaging"
+)
+
+// Color is an opaque color in a palette. In templates it prints as
+// "#rrggbb", and its methods give other notations.
+type Color struct {
+	R, G, B uint8
+}
+
+// String returns the color as "#rrggbb".
+func (c Color) String() string {
+	return c.Hex()
+}
+
+// Hex returns the color as "#rrggbb".
+func (c Color) Hex() string {
+	return "#" + c.Strip()
+}
+
+// Strip returns the color as "rrggbb", without the leading "#".
+func (c Color) Strip() string {
+	return fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// RGB returns the color as "r,g,b".
+func (c Color) RGB() string {
+	return fmt.Sprintf("%d,%d,%d", c.R, c.G, c.B)
+}
+
+// RGBA returns the color as "rgba(r,g,b,alpha)", where alpha is from 0 to
+// 1.
+func (c Color) RGBA(alpha float64) string {
+	return fmt.Sprintf("rgba(%d,%d,%d,%s)", c.R, c.G, c.B, formatFloat(alpha))
+}
+
+// MarshalText encodes the color as "#rrggbb".
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(c.Hex()), nil
+}
+
+// UnmarshalText decodes a color from "#rrggbb".
+func (c *Color) UnmarshalText(text []byte) error {
+	rgba, err := imaging.ParseColor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = Color{R: rgba.R, G: rgba.G, B: rgba.B}
+
+	return nil
+}
+
+// luminance returns the relative luminance of the color, from 0 to 1.
+func (c Color) luminance() float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
+
+// hsl returns the color's hue in degrees, and its saturation and lightness
+// from 0 to 1.
+func (c Color) hsl() (float64, float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l := (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+
+	d := hi - lo
+	s := d / (1 - math.Abs(2*l-1))
+
+	var h float64
+	switch hi {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	return h, s, l
+}
+
+// fromHSL returns the color with the given hue, saturation and lightness.
+func fromHSL(h, s, l float64) Color {
+	s, l = clamp01(s), clamp01(l)
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g = c, x
+	case h < 120:
+		r, g = x, c
+	case h < 180:
+		g, b = c, x
+	case h < 240:
+		g, b = x, c
+	case h < 300:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+
+	return Color{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+	}
+}
+
+// withLightness returns the color with its lightness changed.
+func (c Color) withLightness(l float64) Color {
+	h, s, _ := c.hsl()
+
+	return fromHSL(h, s, l)
+}
+
+// adjust returns the color with its saturation capped and its lightness
+// kept within lo and hi.
+func (c Color) adjust(maxSat, lo, hi float64) Color {
+	h, s, l := c.hsl()
+
+	return fromHSL(h, math.Min(s, maxSat), math.Max(lo, math.Min(l, hi)))
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(v, 1))
+}
+
+// formatFloat formats a float without trailing zeros.
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%g", math.Round(v*1000)/1000)
+}
@@ -0,0 +1,240 @@
+package theme
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshbeard/walsh/internal/imaging"
+	"github.com/joshbeard/walsh/internal/util"
+)
+
+// sampleSize is the longest side images are shrunk to before their colors
+// are counted.
+const sampleSize = 128
+
+// Palette is a 16 color terminal palette in the style of pywal. Colors 0
+// and 7 are the background and foreground shades, 1 to 6 are the image's
+// most common colors, and 8 to 15 are brighter versions of 0 to 7.
+type Palette struct {
+	Wallpaper  string    `json:"wallpaper"`
+	Light      bool      `json:"light"`
+	Background Color     `json:"background"`
+	Foreground Color     `json:"foreground"`
+	Cursor     Color     `json:"cursor"`
+	Colors     [16]Color `json:"colors"`
+}
+
+// Extract builds a palette from the image at path. A light palette has a
+// light background and dark text.
+func Extract(path string, light bool) (Palette, error) {
+	img, err := imaging.Load(path)
+	if err != nil {
+		return Palette{}, err
+	}
+
+	dominant := medianCut(sample(img), 8)
+	if len(dominant) == 0 {
+		return Palette{}, fmt.Errorf("no colors found in %s", path)
+	}
+	sort.Slice(dominant, func(i, j int) bool {
+		return dominant[i].luminance() < dominant[j].luminance()
+	})
+
+	// Pad images with fewer colors, such as solid fills, with the last one.
+	for len(dominant) < 8 {
+		dominant = append(dominant, dominant[len(dominant)-1])
+	}
+
+	p := Palette{Wallpaper: path, Light: light}
+	dark, bright := dominant[0], dominant[7]
+	if light {
+		dark, bright = bright, dark
+		p.Colors[0] = dark.adjust(0.2, 0.9, 0.96)
+		p.Colors[7] = bright.adjust(0.2, 0.15, 0.25)
+		p.Colors[8] = p.Colors[0].withLightness(0.75)
+		p.Colors[15] = p.Colors[7].withLightness(0.08)
+	} else {
+		p.Colors[0] = dark.adjust(0.4, 0.04, 0.1)
+		p.Colors[7] = bright.adjust(0.2, 0.78, 0.85)
+		p.Colors[8] = p.Colors[0].withLightness(0.3)
+		p.Colors[15] = p.Colors[7].withLightness(0.93)
+	}
+
+	// The accents are kept readable against the background.
+	for i, c := range dominant[1:7] {
+		if light {
+			p.Colors[i+1] = c.adjust(0.8, 0.3, 0.45)
+			p.Colors[i+9] = c.adjust(0.9, 0.2, 0.35)
+		} else {
+			p.Colors[i+1] = c.adjust(0.8, 0.5, 0.65)
+			p.Colors[i+9] = c.adjust(0.9, 0.62, 0.75)
+		}
+	}
+
+	p.Background = p.Colors[0]
+	p.Foreground = p.Colors[15]
+	p.Cursor = p.Colors[15]
+
+	return p, nil
+}
+
+// Cached returns the palette for the image at path, reading it from the
+// cache directory if it was extracted before. Palettes are cached by the
+// image's checksum.
+func Cached(path, cacheDir string, light bool) (Palette, error) {
+	hash, err := util.Sha256(path)
+	if err != nil {
+		return Palette{}, err
+	}
+
+	name := fmt.Sprintf("walsh-palette-%s.json", hash[:16])
+	if light {
+		name = fmt.Sprintf("walsh-palette-%s-light.json", hash[:16])
+	}
+	cachePath := filepath.Join(cacheDir, name)
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var p Palette
+		if err = json.Unmarshal(data, &p); err == nil {
+			log.Debugf("Using cached palette %s", cachePath)
+			p.Wallpaper = path
+
+			return p, nil
+		}
+		log.Warnf("Ignoring invalid cached palette %s: %s", cachePath, err)
+	}
+
+	p, err := Extract(path, light)
+	if err != nil {
+		return Palette{}, err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return Palette{}, err
+	}
+	if err = os.WriteFile(cachePath, data, 0o644); err != nil {
+		log.Warnf("Error caching palette: %s", err)
+	}
+
+	return p, nil
+}
+
+// sample shrinks an image and returns its pixels.
+func sample(img image.Image) []Color {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > sampleSize || h > sampleSize {
+		if w >= h {
+			w, h = sampleSize, max(1, h*sampleSize/w)
+		} else {
+			w, h = max(1, w*sampleSize/h), sampleSize
+		}
+		img = imaging.Resize(img, b, w, h)
+		b = img.Bounds()
+	}
+
+	pixels := make([]Color, 0, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, Color{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(bl >> 8)})
+		}
+	}
+
+	return pixels
+}
+
+// medianCut splits the pixels into up to n boxes of similar colors, each
+// time splitting the box with the widest range along its widest channel,
+// and returns the average color of each box, most common first.
+func medianCut(pixels []Color, n int) []Color {
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	boxes := [][]Color{pixels}
+	for len(boxes) < n {
+		widest, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, s := widestChannel(box); s > spread {
+				widest, channel, spread = i, c, s
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.Slice(box, func(i, j int) bool {
+			return channelValue(box[i], channel) < channelValue(box[j], channel)
+		})
+		mid := len(box) / 2
+		boxes[widest] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	sort.SliceStable(boxes, func(i, j int) bool { return len(boxes[i]) > len(boxes[j]) })
+
+	colors := make([]Color, 0, len(boxes))
+	for _, box := range boxes {
+		colors = append(colors, average(box))
+	}
+
+	return colors
+}
+
+// widestChannel returns the channel (0 for red, 1 for green, 2 for blue)
+// with the widest range of values in the box, and that range.
+func widestChannel(box []Color) (int, int) {
+	lo := [3]int{255, 255, 255}
+	hi := [3]int{}
+	for _, c := range box {
+		for ch := 0; ch < 3; ch++ {
+			v := channelValue(c, ch)
+			lo[ch] = min(lo[ch], v)
+			hi[ch] = max(hi[ch], v)
+		}
+	}
+
+	channel := 0
+	for ch := 1; ch < 3; ch++ {
+		if hi[ch]-lo[ch] > hi[channel]-lo[channel] {
+			channel = ch
+		}
+	}
+
+	return channel, hi[channel] - lo[channel]
+}
+
+func channelValue(c Color, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	default:
+		return int(c.B)
+	}
+}
+
+// average returns the mean color of the box.
+func average(box []Color) Color {
+	var r, g, b int
+	for _, c := range box {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+	}
+	n := len(box)
+
+	return Color{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n)}
+}
@@ -0,0 +1,54 @@
+package theme
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// data returns the values available to templates: Wallpaper, Light,
+// Background, Foreground, Cursor, Colors and Color0 to Color15.
+func (p Palette) data() map[string]any {
+	data := map[string]any{
+		"Wallpaper":  p.Wallpaper,
+		"Light":      p.Light,
+		"Background": p.Background,
+		"Foreground": p.Foreground,
+		"Cursor":     p.Cursor,
+		"Colors":     p.Colors,
+	}
+	for i, c := range p.Colors {
+		data[fmt.Sprintf("Color%d", i)] = c
+	}
+
+	return data
+}
+
+// Render executes the Go template at templatePath with the palette and
+// writes the result to outputPath, creating its directory if needed.
+func Render(p Palette, templatePath, outputPath string) error {
+	tmpl, err := template.New(filepath.Base(templatePath)).Option("missingkey=error").ParseFiles(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, p.data()); err != nil {
+		return fmt.Errorf("failed to render template %s: %w", templatePath, err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so programs watching the output
+	// never read it half-written.
+	tmp := outputPath + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, outputPath)
+}
@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/charmbracelet/log"
 )
@@ -80,6 +82,22 @@ func WriteFile(filename string, data []byte) error {
 	return nil
 }
 
+// TempPath creates an empty temporary file in the same directory as path,
+// with the same extension, and returns its path. Writing to it and renaming
+// it to path means readers never see a half-written file, even when two
+// processes write the same file at once.
+func TempPath(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+base+".*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	return f.Name(), f.Close()
+}
+
 // FileExists returns true if the file exists at the given path.
 func FileExists(filename string) bool {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -177,3 +195,24 @@ func SortFilesByMTime(files []os.DirEntry) {
 		return infoI.ModTime().Before(infoJ.ModTime())
 	})
 }
+
+// StartCmd starts the given command in the background in a new session, so
+// it keeps running after walsh exits, and returns its process ID.
+func StartCmd(cmd string) (int, error) {
+	// exec replaces the shell, so the returned PID is the command's own.
+	command := exec.Command("sh", "-c", "exec "+cmd)
+	command.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	log.Debugf("Starting command: %s", cmd)
+	if err := command.Start(); err != nil {
+		return 0, err
+	}
+
+	// Reap the process when it exits if walsh is still running, e.g. when
+	// setting wallpapers at an interval.
+	go func() {
+		_ = command.Wait()
+	}()
+
+	return command.Process.Pid, nil
+}
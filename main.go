@@ -13,11 +13,16 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/joshbeard/walsh/cmd/blacklist"
+	"github.com/joshbeard/walsh/cmd/dedupe"
 	"github.com/joshbeard/walsh/cmd/diag"
 	"github.com/joshbeard/walsh/cmd/download"
+	"github.com/joshbeard/walsh/cmd/fsck"
 	"github.com/joshbeard/walsh/cmd/list"
+	"github.com/joshbeard/walsh/cmd/lockscreen"
 	"github.com/joshbeard/walsh/cmd/set"
+	"github.com/joshbeard/walsh/cmd/theme"
 	"github.com/joshbeard/walsh/cmd/view"
+	"github.com/joshbeard/walsh/cmd/workspaces"
 )
 
 // Set at build time
@@ -66,16 +71,24 @@ func Command() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(blacklist.Command())
+	rootCmd.AddCommand(dedupe.Command())
 	rootCmd.AddCommand(diag.Command())
 	rootCmd.AddCommand(list.Command())
+	rootCmd.AddCommand(lockscreen.Command())
 	rootCmd.AddCommand(set.Command())
 	rootCmd.AddCommand(download.Command())
+	rootCmd.AddCommand(fsck.Command())
+	rootCmd.AddCommand(theme.Command())
 	rootCmd.AddCommand(view.Command())
+	rootCmd.AddCommand(workspaces.Command())
 	rootCmd.AddCommand(list.AddCommand())
 
 	rootCmd.PersistentFlags().StringP("config", "c", "", "path to config file")
 	rootCmd.PersistentFlags().StringP("display", "d", "",
-		"display to use for operations")
+		"display to use for operations, by index, name or monitor description")
+	rootCmd.PersistentFlags().StringP("backend", "b", "",
+		"session and set tool to use, as session[:tool] (e.g. sway:swaybg); "+
+			"overrides WALSH_BACKEND and the config")
 	rootCmd.PersistentFlags().StringP("log-level", "L", "info",
 		"log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().StringP("log-file", "", "",